@@ -1,6 +1,10 @@
 package jsonrpc
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
 type Error interface {
 	Code() int64
@@ -35,6 +39,8 @@ const (
 	LimitExceeded ErrorConst = -32005
 	// (EIP-1474) Version of JSON-RPC protocol is not supported
 	JSONRPCVersionNotSupported ErrorConst = -32006
+	// The request was not handled before the deadline, see BatchTimeout.
+	RequestTimeout ErrorConst = -32098
 	// (EIP-1193) The user rejected the request.
 	UserRejectedRequest ErrorConst = 4001
 	// (EIP-1193) The requested method and/or account has not been authorized by the user.
@@ -77,6 +83,8 @@ func (c ErrorConst) Message() string {
 		return "Limit exceeded"
 	case JSONRPCVersionNotSupported:
 		return "JSON-RPC version not supported"
+	case RequestTimeout:
+		return "Request timeout"
 	case UserRejectedRequest:
 		return "User Rejected Request"
 	case Unauthorized:
@@ -92,8 +100,81 @@ func (c ErrorConst) Message() string {
 	}
 }
 
+// Error implements the error interface, so that MessageError matches the code with errors.Is,
+// and handlers can return a wrapped constant, e.g. fmt.Errorf("unknown block: %w", ResourceNotFound),
+// which AsErrorObj responds to with the code and message of the constant.
+func (c ErrorConst) Error() string {
+	return c.Message()
+}
+
 // IsServerError identifies server errors, per standard JSON-RPC 2.0 error code scheme.
 // Reserved for implementation-defined server-errors.
 func (c ErrorConst) IsServerError() bool {
 	return c < -32000 && c > -32099
 }
+
+// HTTPStatus maps the error code to the HTTP status code of a response with the error,
+// e.g. for REST-style gateways. Non-standard codes map to 500 Internal Server Error.
+func (c ErrorConst) HTTPStatus() int {
+	switch c {
+	case ParseErr, InvalidRequest, InvalidParams, InvalidInput, JSONRPCVersionNotSupported:
+		return http.StatusBadRequest
+	case MethodNotFound, ResourceNotFound:
+		return http.StatusNotFound
+	case MethodNotSupported, UnsupportedMethod:
+		return http.StatusNotImplemented
+	case TransactionRejected:
+		return http.StatusUnprocessableEntity
+	case LimitExceeded:
+		return http.StatusTooManyRequests
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case UserRejectedRequest:
+		return http.StatusForbidden
+	case ResourceUnavailable, Disconnected, ChainDisconnected:
+		return http.StatusServiceUnavailable
+	case RequestTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// MessageError describes why a message is invalid, with the error code to respond with:
+// ParseErr if the message is not valid JSON, InvalidRequest if it is not a valid JSON-RPC message.
+// It matches its code with errors.Is, e.g. errors.Is(err, InvalidRequest).
+type MessageError struct {
+	Code ErrorConst
+	Err  error
+}
+
+func (e *MessageError) Error() string {
+	return e.Code.Message() + ": " + e.Err.Error()
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MessageError) Is(target error) bool {
+	c, ok := target.(ErrorConst)
+	return ok && c == e.Code
+}
+
+// ErrorObject converts the error into an error object, to respond with.
+func (e *MessageError) ErrorObject() *ErrorObject {
+	return AnnotatedErrorObj(e.Code, e.Err)
+}
+
+func invalidRequest(err error) *MessageError {
+	return &MessageError{Code: InvalidRequest, Err: err}
+}
+
+// asMessageError classifies the error with the code, if it is not a MessageError already.
+func asMessageError(err error, code ErrorConst) error {
+	var mErr *MessageError
+	if errors.As(err, &mErr) {
+		return err
+	}
+	return &MessageError{Code: code, Err: err}
+}
@@ -0,0 +1,150 @@
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxBodySize is the default limit of HTTP request bodies, and of other received payloads.
+const DefaultMaxBodySize = 5 << 20
+
+// HTTPOption configures NewHTTPHandler.
+type HTTPOption func(cfg *httpConfig)
+
+type httpConfig struct {
+	maxBodySize  int64
+	serveOptions []ServeOption
+}
+
+// MaxBodySize limits the size of HTTP request bodies, DefaultMaxBodySize by default.
+func MaxBodySize(n int64) HTTPOption {
+	return func(cfg *httpConfig) {
+		cfg.maxBodySize = n
+	}
+}
+
+// WithServeOptions configures how the handler serves the payload of each HTTP request, see Serve.
+func WithServeOptions(opts ...ServeOption) HTTPOption {
+	return func(cfg *httpConfig) {
+		cfg.serveOptions = append(cfg.serveOptions, opts...)
+	}
+}
+
+// HTTPHandler serves JSON-RPC messages, single or batched, in the body of HTTP POST requests.
+type HTTPHandler struct {
+	handler Handler
+	cfg     httpConfig
+}
+
+var _ http.Handler = (*HTTPHandler)(nil)
+
+// NewHTTPHandler creates an http.Handler that serves the JSON-RPC handler.
+func NewHTTPHandler(h Handler, opts ...HTTPOption) *HTTPHandler {
+	cfg := httpConfig{maxBodySize: DefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &HTTPHandler{handler: h, cfg: cfg}
+}
+
+// ServeHTTP responds with status 200 and the JSON-RPC response payload,
+// or with status 204 and no body if the payload only contains notifications.
+// Invalid JSON results in a ParseErr response with status 200, like other JSON-RPC errors do,
+// and a body larger than the limit results in a LimitExceeded response with status 413.
+// Requests with a method other than POST, a Content-Type other than JSON,
+// or an Accept header that excludes JSON, are rejected with plain HTTP errors.
+func (s *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed, JSON-RPC requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isJSONContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "unsupported content type, JSON-RPC requires application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if !acceptsJSON(r.Header.Values("Accept")) {
+		http.Error(w, "not acceptable, JSON-RPC responds with application/json", http.StatusNotAcceptable)
+		return
+	}
+	body, ok := readBody(w, r, s.cfg.maxBodySize)
+	if !ok {
+		return
+	}
+	out := Serve(r.Context(), body, s.handler, s.cfg.serveOptions...)
+	if out == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// readBody reads the request body up to the limit, or responds with an error and returns false.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if !errors.As(err, &maxErr) {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return nil, false
+		}
+		err = fmt.Errorf("request body exceeds %d bytes", maxErr.Limit)
+		writeJSON(w, http.StatusRequestEntityTooLarge, encodeResponse(errorResponse("null", &MessageError{Code: LimitExceeded, Err: err})))
+		return nil, false
+	}
+	return body, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// isJSONContentType checks if the Content-Type is one of the JSON-RPC media types.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/json", "application/json-rpc", "application/jsonrequest":
+		return true
+	default:
+		return false
+	}
+}
+
+// acceptsJSON checks if the Accept header values allow an application/json response.
+// A missing or empty Accept header accepts anything.
+func acceptsJSON(accept []string) bool {
+	empty := true
+	for _, v := range accept {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			empty = false
+			mediaType, params, err := mime.ParseMediaType(item)
+			if err != nil {
+				continue
+			}
+			if q, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(q, 64); err != nil || f <= 0 {
+					continue
+				}
+			}
+			switch mediaType {
+			case "*/*", "application/*", "application/json":
+				return true
+			}
+		}
+	}
+	return empty
+}
@@ -0,0 +1,233 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// maximum length of the response body included in an HTTPError
+const maxHTTPErrorBody = 512
+
+// HTTPError is returned by HTTPClient when the server responds with a non-2xx status.
+// JSON-RPC errors of a successful HTTP response are returned as ErrorObject instead.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	// Body is the start of the response body, for diagnostics.
+	Body []byte
+}
+
+func (e *HTTPError) Error() string {
+	if len(e.Body) == 0 {
+		return "HTTP error: " + e.Status
+	}
+	return fmt.Sprintf("HTTP error: %s: %s", e.Status, e.Body)
+}
+
+// ResponseTooLargeError is returned by HTTPClient when the response body, after decompression, exceeds the limit.
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds %d bytes", e.Limit)
+}
+
+// HTTPClientOption configures NewHTTPClient.
+type HTTPClientOption func(cfg *httpClientConfig)
+
+type httpClientConfig struct {
+	client          *http.Client
+	header          http.Header
+	maxResponseSize int64
+}
+
+// WithHTTPClient sets the HTTP client to send requests with, http.DefaultClient by default.
+// Connections are reused as configured by the transport of the client.
+func WithHTTPClient(client *http.Client) HTTPClientOption {
+	return func(cfg *httpClientConfig) {
+		cfg.client = client
+	}
+}
+
+// MaxResponseSize limits the size of HTTP response bodies, after decompression, DefaultMaxBodySize by default.
+func MaxResponseSize(n int64) HTTPClientOption {
+	return func(cfg *httpClientConfig) {
+		cfg.maxResponseSize = n
+	}
+}
+
+// WithHeader adds a header to every HTTP request, e.g. an authorization token.
+func WithHeader(key, value string) HTTPClientOption {
+	return func(cfg *httpClientConfig) {
+		cfg.header.Add(key, value)
+	}
+}
+
+type httpHeaderKey struct{}
+
+// WithHTTPHeader returns a context that adds the header to the HTTP requests sent with it,
+// e.g. a request ID. Headers of the parent context are retained.
+func WithHTTPHeader(ctx context.Context, key, value string) context.Context {
+	h := http.Header{}
+	if parent, ok := ctx.Value(httpHeaderKey{}).(http.Header); ok {
+		h = parent.Clone()
+	}
+	h.Add(key, value)
+	return context.WithValue(ctx, httpHeaderKey{}, h)
+}
+
+// HTTPClient sends JSON-RPC messages to an endpoint, with HTTP POST requests.
+type HTTPClient struct {
+	url    string
+	cfg    httpClientConfig
+	lastID atomic.Uint64
+}
+
+// NewHTTPClient creates a client for the JSON-RPC endpoint at the URL.
+func NewHTTPClient(url string, opts ...HTTPClientOption) *HTTPClient {
+	cfg := httpClientConfig{client: http.DefaultClient, header: http.Header{}, maxResponseSize: DefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &HTTPClient{url: url, cfg: cfg}
+}
+
+// Call sends a request, and decodes the result into the result value, unless it is nil.
+// An error response is returned as *ErrorObject, and HTTP failures as *HTTPError.
+func (c *HTTPClient) Call(ctx context.Context, method string, params any, result any) error {
+	id := RawID(strconv.FormatUint(c.lastID.Add(1), 10))
+	req, err := NewRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+	resp, status, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return fmt.Errorf("missing response: HTTP %s without body", status)
+	}
+	// the server may not know the ID, e.g. if it failed to parse the request
+	if resp.Error != nil && resp.ID == "null" {
+		return resp.Error
+	}
+	if resp.ID != id {
+		return fmt.Errorf("response ID %s does not match request ID %s", resp.ID, id)
+	}
+	return decodeResult(resp, result)
+}
+
+// Notify sends a notification.
+func (c *HTTPClient) Notify(ctx context.Context, method string, params any) error {
+	req, err := NewNotification(method, params)
+	if err != nil {
+		return err
+	}
+	_, err = c.Send(ctx, req)
+	return err
+}
+
+// Send sends a single message, and returns the response message, nil if the server did not respond with one.
+func (c *HTTPClient) Send(ctx context.Context, msg *Message) (*Message, error) {
+	resp, _, err := c.send(ctx, msg)
+	return resp, err
+}
+
+// send is like Send, and also returns the HTTP status, for diagnostics.
+func (c *HTTPClient) send(ctx context.Context, msg *Message) (*Message, string, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, "", err
+	}
+	body, status, err := c.post(ctx, payload)
+	if err != nil || body == nil {
+		return nil, status, err
+	}
+	resp, err := DecodeMessage(body)
+	return resp, status, err
+}
+
+// SendBatch sends the messages as batch, and returns the response messages, nil if the server did not respond.
+// Responses may be in any order, and match requests by ID.
+// If the server rejects the batch as a whole, the error response is returned as *ErrorObject.
+func (c *HTTPClient) SendBatch(ctx context.Context, msgs []*Message) ([]*Message, error) {
+	payload, err := json.Marshal(msgs)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := c.post(ctx, payload)
+	if err != nil || body == nil {
+		return nil, err
+	}
+	if body = trimSpace(body); len(body) > 0 && body[0] == '{' {
+		resp, err := DecodeMessage(body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Error == nil {
+			return nil, errors.New("expected batch response, got single success response")
+		}
+		return nil, resp.Error
+	}
+	var out []*Message
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// post sends the payload, and returns the response body, nil if there is none, and the HTTP status.
+func (c *HTTPClient) post(ctx context.Context, payload []byte) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header = c.cfg.header.Clone()
+	if h, ok := ctx.Value(httpHeaderKey{}).(http.Header); ok {
+		for k, v := range h {
+			req.Header[k] = append(req.Header[k], v...)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	// requested explicitly, to also decompress responses if the transport does not
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := c.cfg.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	var r io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, resp.Status, fmt.Errorf("invalid gzip response: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(r, maxHTTPErrorBody))
+		return nil, resp.Status, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+	}
+	body, err := io.ReadAll(io.LimitReader(r, c.cfg.maxResponseSize+1))
+	if err != nil {
+		return nil, resp.Status, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(body)) > c.cfg.maxResponseSize {
+		return nil, resp.Status, &ResponseTooLargeError{Limit: c.cfg.maxResponseSize}
+	}
+	if len(trimSpace(body)) == 0 {
+		return nil, resp.Status, nil
+	}
+	return body, resp.Status, nil
+}
@@ -0,0 +1,171 @@
+package jsonrpc
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	w.Header().Del("Content-Length") // of the uncompressed body
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	return w.gz.Write(data)
+}
+
+func TestHTTPClient(t *testing.T) {
+	var lastHeader http.Header
+	rpc := NewHTTPHandler(specHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastHeader = r.Header.Clone()
+		switch r.URL.Path {
+		case "/unavailable":
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		case "/null-id":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`))
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			rpc.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, gz: gz}, r)
+		default:
+			rpc.ServeHTTP(w, r)
+		}
+	}))
+	defer srv.Close()
+	client := NewHTTPClient(srv.URL, WithHTTPClient(srv.Client()), WithHeader("Authorization", "Bearer secret"))
+
+	t.Run("call", func(t *testing.T) {
+		var result int
+		if err := client.Call(context.Background(), "subtract", []int{42, 23}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 19 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+	})
+	t.Run("headers", func(t *testing.T) {
+		ctx := WithHTTPHeader(context.Background(), "X-Request-Id", "abc")
+		ctx = WithHTTPHeader(ctx, "X-Request-Id", "def")
+		if err := client.Call(ctx, "sum", []int{1}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if auth := lastHeader.Get("Authorization"); auth != "Bearer secret" {
+			t.Fatalf("unexpected Authorization header: %q", auth)
+		}
+		if ids := lastHeader.Values("X-Request-Id"); !reflect.DeepEqual(ids, []string{"abc", "def"}) {
+			t.Fatalf("unexpected X-Request-Id headers: %q", ids)
+		}
+		if err := client.Call(context.Background(), "sum", []int{1}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if ids := lastHeader.Values("X-Request-Id"); len(ids) != 0 {
+			t.Fatalf("per-call header leaked into other calls: %q", ids)
+		}
+	})
+	t.Run("error response", func(t *testing.T) {
+		err := client.Call(context.Background(), "foo.get", nil, nil)
+		var obj *ErrorObject
+		if !errors.As(err, &obj) || obj.Code != MethodNotFound.Code() {
+			t.Fatalf("expected method not found error object, got %v", err)
+		}
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			t.Fatal("error response must not be an HTTP error")
+		}
+	})
+	t.Run("http error", func(t *testing.T) {
+		err := NewHTTPClient(srv.URL+"/unavailable").Call(context.Background(), "sum", []int{1}, nil)
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable ||
+			!strings.Contains(string(httpErr.Body), "maintenance") {
+			t.Fatalf("expected HTTP error, got %v", err)
+		}
+		var obj *ErrorObject
+		if errors.As(err, &obj) {
+			t.Fatal("HTTP error must not be an error object")
+		}
+	})
+	t.Run("error response without id", func(t *testing.T) {
+		err := NewHTTPClient(srv.URL+"/null-id").Call(context.Background(), "sum", []int{1}, nil)
+		var obj *ErrorObject
+		if !errors.As(err, &obj) || obj.Code != InvalidRequest.Code() {
+			t.Fatalf("expected invalid request error object, got %v", err)
+		}
+	})
+	t.Run("no content", func(t *testing.T) {
+		err := NewHTTPClient(srv.URL+"/no-content").Call(context.Background(), "sum", []int{1}, nil)
+		if err == nil || !strings.Contains(err.Error(), "204 No Content") {
+			t.Fatalf("expected missing response error with HTTP status, got %v", err)
+		}
+	})
+	t.Run("gzip", func(t *testing.T) {
+		// a transport without transparent decompression, so the client has to decompress
+		gzClient := NewHTTPClient(srv.URL+"/gzip", WithHTTPClient(&http.Client{Transport: &http.Transport{DisableCompression: true}}))
+		var result int
+		if err := gzClient.Call(context.Background(), "sum", []int{1, 2, 3}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 6 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+		if enc := lastHeader.Get("Accept-Encoding"); enc != "gzip" {
+			t.Fatalf("unexpected Accept-Encoding header: %q", enc)
+		}
+	})
+	t.Run("response too large", func(t *testing.T) {
+		small := NewHTTPClient(srv.URL, WithHTTPClient(srv.Client()), MaxResponseSize(10))
+		err := small.Call(context.Background(), "sum", []int{1}, nil)
+		var sizeErr *ResponseTooLargeError
+		if !errors.As(err, &sizeErr) || sizeErr.Limit != 10 {
+			t.Fatalf("expected response too large error, got %v", err)
+		}
+		gzSmall := NewHTTPClient(srv.URL+"/gzip", MaxResponseSize(10),
+			WithHTTPClient(&http.Client{Transport: &http.Transport{DisableCompression: true}}))
+		if err := gzSmall.Call(context.Background(), "sum", []int{1}, nil); !errors.As(err, &sizeErr) {
+			t.Fatalf("expected decompressed response to be limited, got %v", err)
+		}
+	})
+	t.Run("notify", func(t *testing.T) {
+		if err := client.Notify(context.Background(), "notify_hello", []int{7}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("batch", func(t *testing.T) {
+		a, _ := NewRequest("1", "sum", []int{1, 2})
+		b, _ := NewNotification("notify_hello", nil)
+		c, _ := NewRequest("2", "foo.get", nil)
+		resps, err := client.SendBatch(context.Background(), []*Message{a, b, c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resps) != 2 || resps[0].ID != "1" || string(resps[0].RawResult()) != "3" ||
+			resps[1].ID != "2" || resps[1].Error == nil {
+			t.Fatalf("unexpected batch responses: %v", resps)
+		}
+		resps, err = client.SendBatch(context.Background(), []*Message{b})
+		if err != nil || resps != nil {
+			t.Fatalf("expected no responses, got %v, %v", resps, err)
+		}
+		_, err = client.SendBatch(context.Background(), []*Message{})
+		var obj *ErrorObject
+		if !errors.As(err, &obj) || obj.Code != InvalidRequest.Code() {
+			t.Fatalf("expected invalid request error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package jsonrpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	srv := httptest.NewServer(NewHTTPHandler(specHandler, MaxBodySize(1024)))
+	defer srv.Close()
+	for _, tc := range []struct {
+		name        string
+		method      string
+		contentType string
+		accept      string
+		body        string
+		status      int
+		expected    string
+	}{
+		{name: "request", body: `{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}`,
+			status: 200, expected: `{"jsonrpc": "2.0", "result": 19, "id": 1}`},
+		{name: "batch", body: `[{"jsonrpc": "2.0", "method": "sum", "params": [1, 2], "id": 1}, {"jsonrpc": "2.0", "method": "notify_hello"}]`,
+			status: 200, expected: `[{"jsonrpc": "2.0", "result": 3, "id": 1}]`},
+		{name: "notification", body: `{"jsonrpc": "2.0", "method": "notify_hello", "params": [7]}`,
+			status: 204},
+		{name: "notification batch", body: `[{"jsonrpc": "2.0", "method": "notify_hello"}, {"jsonrpc": "2.0", "method": "notify_sum"}]`,
+			status: 204},
+		{name: "parse error", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1, 2`,
+			status: 200, expected: `{"jsonrpc": "2.0", "error": {"code": -32700}, "id": null}`},
+		{name: "empty body", body: ``,
+			status: 200, expected: `{"jsonrpc": "2.0", "error": {"code": -32700}, "id": null}`},
+		{name: "too large", body: `{"jsonrpc": "2.0", "method": "sum", "params": [` + strings.Repeat("1,", 1000) + `1], "id": 1}`,
+			status: 413, expected: `{"jsonrpc": "2.0", "error": {"code": -32005}, "id": null}`},
+		{name: "charset", contentType: "application/json; charset=utf-8", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1}`,
+			status: 200, expected: `{"jsonrpc": "2.0", "result": 1, "id": 1}`},
+		{name: "json-rpc content type", contentType: "application/json-rpc", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1}`,
+			status: 200, expected: `{"jsonrpc": "2.0", "result": 1, "id": 1}`},
+		{name: "wrong content type", contentType: "text/plain", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1}`,
+			status: 415},
+		{name: "missing content type", contentType: "-", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1}`,
+			status: 415},
+		{name: "accept json", accept: "text/html, application/json;q=0.9", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1}`,
+			status: 200, expected: `{"jsonrpc": "2.0", "result": 1, "id": 1}`},
+		{name: "accept wildcard", accept: "*/*", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1}`,
+			status: 200, expected: `{"jsonrpc": "2.0", "result": 1, "id": 1}`},
+		{name: "not acceptable", accept: "text/html", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1}`,
+			status: 406},
+		{name: "json excluded", accept: "application/json;q=0", body: `{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1}`,
+			status: 406},
+		{name: "GET", method: http.MethodGet, status: 405},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req, err := http.NewRequest(method, srv.URL, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch tc.contentType {
+			case "":
+				req.Header.Set("Content-Type", "application/json")
+			case "-":
+			default:
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, resp.StatusCode, body)
+			}
+			if tc.status == 204 && len(body) != 0 {
+				t.Fatalf("expected no body, got %s", body)
+			}
+			if tc.expected == "" {
+				return
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("unexpected content type: %q", ct)
+			}
+			checkServeOutput(t, body, tc.expected)
+		})
+	}
+	t.Run("allow header", func(t *testing.T) {
+		resp, err := srv.Client().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if allow := resp.Header.Get("Allow"); allow != http.MethodPost {
+			t.Fatalf("unexpected Allow header: %q", allow)
+		}
+	})
+}
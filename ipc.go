@@ -0,0 +1,129 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// IPCOption configures IPC servers and connections.
+type IPCOption func(cfg *ipcConfig)
+
+type ipcConfig struct {
+	perm        fs.FileMode
+	readLimit   int64
+	peerOptions []PeerOption
+}
+
+func newIPCConfig(opts []IPCOption) ipcConfig {
+	cfg := ipcConfig{perm: 0o600}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// IPCPermissions sets the file permissions of the socket, 0600 by default, so only the owner can connect.
+func IPCPermissions(perm fs.FileMode) IPCOption {
+	return func(cfg *ipcConfig) {
+		cfg.perm = perm
+	}
+}
+
+// IPCReadLimit limits the size of received payloads, DefaultMaxBodySize by default.
+func IPCReadLimit(n int64) IPCOption {
+	return func(cfg *ipcConfig) {
+		cfg.readLimit = n
+	}
+}
+
+// IPCPeerOptions configures the peers of connections served by IPCServer.
+func IPCPeerOptions(opts ...PeerOption) IPCOption {
+	return func(cfg *ipcConfig) {
+		cfg.peerOptions = append(cfg.peerOptions, opts...)
+	}
+}
+
+// IPCServer serves JSON-RPC on a Unix domain socket, with concatenated JSON messages, like geth.ipc.
+// Each connection is served by a Peer, so handlers can notify the client with the Notifier in the request context.
+type IPCServer struct {
+	path string
+	srv  *streamServer
+}
+
+// ListenIPC creates the socket at the path, with the configured permissions.
+// A stale socket file of a previous server is removed, but a socket that is still in use, or any other file, is not.
+// Serve must be called to accept connections.
+func ListenIPC(path string, h Handler, opts ...IPCOption) (*IPCServer, error) {
+	cfg := newIPCConfig(opts)
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o751); err != nil {
+		return nil, err
+	}
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, cfg.perm); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return &IPCServer{
+		path: path,
+		srv:  newStreamServer(listener, h, cfg.readLimit, cfg.peerOptions),
+	}, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("cannot listen on %s: file exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("cannot listen on %s: socket is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// Addr returns the socket path.
+func (s *IPCServer) Addr() string {
+	return s.path
+}
+
+// Serve accepts and serves connections, until the server is closed. It returns nil after Close.
+func (s *IPCServer) Serve() error {
+	return s.srv.serve()
+}
+
+// Close stops accepting connections, closes the open connections, waits for their handlers to return,
+// and removes the socket file.
+func (s *IPCServer) Close() error {
+	// closing the listener removes the socket file
+	return s.srv.close()
+}
+
+// DialIPC connects to the Unix domain socket at the path, e.g. geth.ipc.
+// The returned connection is used with NewPeer, to call the server.
+func DialIPC(ctx context.Context, path string, opts ...IPCOption) (*StreamConn, error) {
+	cfg := newIPCConfig(opts)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamConn(conn, cfg.readLimit), nil
+}
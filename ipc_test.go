@@ -0,0 +1,219 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newIPCServer(t *testing.T, path string, h Handler, opts ...IPCOption) *IPCServer {
+	t.Helper()
+	srv, err := ListenIPC(path, h, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve() }()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		if err := <-served; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return srv
+}
+
+func dialIPCPeer(t *testing.T, path string, h Handler) *Peer {
+	t.Helper()
+	conn, err := DialIPC(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := NewPeer(conn, h)
+	go func() { _ = peer.Run(context.Background()) }()
+	t.Cleanup(func() { _ = peer.Close() })
+	return peer
+}
+
+func TestIPC(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("call", func(t *testing.T) {
+		path := filepath.Join(dir, "call.ipc")
+		newIPCServer(t, path, specHandler)
+		peer := dialIPCPeer(t, path, nil)
+		var result int
+		if err := peer.Call(context.Background(), "subtract", []int{42, 23}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 19 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+	})
+	t.Run("concatenated", func(t *testing.T) {
+		path := filepath.Join(dir, "concat.ipc")
+		newIPCServer(t, path, specHandler)
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte(`{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}{"jsonrpc":"2.0","method":"notify_hello","params":[7]}` +
+			`{"jsonrpc":"2.0","method":"subtract","params":[5,1],"id":2}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		got := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[line] = true
+		}
+		for _, expected := range []string{
+			`{"result":1,"id":1,"jsonrpc":"2.0"}` + "\n",
+			`{"result":4,"id":2,"jsonrpc":"2.0"}` + "\n",
+		} {
+			if !got[expected] {
+				t.Fatalf("missing %q in %v", expected, got)
+			}
+		}
+	})
+	t.Run("notifications", func(t *testing.T) {
+		path := filepath.Join(dir, "notify.ipc")
+		newIPCServer(t, path, HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			n, ok := NotifierFromContext(ctx)
+			if !ok {
+				return req.RespondErr(ConstErrorObj(InternalError))
+			}
+			if err := n.Notify(ctx, "hello", []int{1}); err != nil {
+				return req.RespondErr(AsErrorObj(err))
+			}
+			return req.Respond(true)
+		}))
+		notified := make(chan string, 1)
+		peer := dialIPCPeer(t, path, HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			notified <- req.Method
+			return nil
+		}))
+		if err := peer.Call(context.Background(), "subscribe", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case method := <-notified:
+			if method != "hello" {
+				t.Fatalf("unexpected notification: %s", method)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+		}
+	})
+	t.Run("permissions", func(t *testing.T) {
+		path := filepath.Join(dir, "perm.ipc")
+		newIPCServer(t, path, specHandler)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Type() != fs.ModeSocket || info.Mode().Perm() != 0o600 {
+			t.Fatalf("unexpected mode: %s", info.Mode())
+		}
+		path = filepath.Join(dir, "sub", "shared.ipc")
+		newIPCServer(t, path, specHandler, IPCPermissions(0o660))
+		if info, err = os.Stat(path); err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o660 {
+			t.Fatalf("unexpected mode: %s", info.Mode())
+		}
+	})
+	t.Run("stale socket", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.ipc")
+		l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.SetUnlinkOnClose(false)
+		_ = l.Close()
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected stale socket file: %v", err)
+		}
+		newIPCServer(t, path, specHandler)
+		peer := dialIPCPeer(t, path, nil)
+		if err := peer.Call(context.Background(), "subtract", []int{2, 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("in use", func(t *testing.T) {
+		path := filepath.Join(dir, "used.ipc")
+		newIPCServer(t, path, specHandler)
+		if _, err := ListenIPC(path, specHandler); err == nil {
+			t.Fatal("expected socket in use error")
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("socket in use must not be removed: %v", err)
+		}
+	})
+	t.Run("not a socket", func(t *testing.T) {
+		path := filepath.Join(dir, "file.ipc")
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ListenIPC(path, specHandler); err == nil {
+			t.Fatal("expected error")
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+			t.Fatalf("file must not be removed: %v", err)
+		}
+	})
+	t.Run("close", func(t *testing.T) {
+		path := filepath.Join(dir, "close.ipc")
+		started := make(chan struct{})
+		stopped := make(chan struct{})
+		srv, err := ListenIPC(path, HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			close(started)
+			<-ctx.Done()
+			close(stopped)
+			return req.RespondErr(AsErrorObj(ctx.Err()))
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		served := make(chan error, 1)
+		go func() { served <- srv.Serve() }()
+		peer := dialIPCPeer(t, path, nil)
+		called := make(chan error, 1)
+		go func() { called <- peer.Call(context.Background(), "block", nil, nil) }()
+		<-started
+		if err := srv.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// Close waits for handlers to return
+		select {
+		case <-stopped:
+		default:
+			t.Fatal("handler still running after close")
+		}
+		if err := <-served; err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+		if err := <-called; !errors.Is(err, ErrPeerClosed) {
+			t.Fatalf("expected closed peer, got %v", err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected socket file to be removed: %v", err)
+		}
+		if _, err := DialIPC(context.Background(), path); err == nil {
+			t.Fatal("expected dial to fail after close")
+		}
+	})
+}
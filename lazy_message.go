@@ -0,0 +1,183 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// LazyMessage is a JSON-RPC message that retains its original encoding,
+// for proxies that pass messages through after inspecting a few members.
+// Members are decoded on demand, and setting a member only patches the bytes of that member.
+//
+// The encoding is byte-for-byte preserved by Bytes.
+// Note that json.Marshal compacts the output of MarshalJSON, which removes insignificant whitespace.
+type LazyMessage struct {
+	data  []byte
+	spans messageSpans
+}
+
+var _ json.Marshaler = (*LazyMessage)(nil)
+var _ json.Unmarshaler = (*LazyMessage)(nil)
+
+// ParseLazyMessage scans and checks the message, without decoding it.
+// The data is retained, and must not be modified afterward.
+func ParseLazyMessage(data []byte) (*LazyMessage, error) {
+	m := &LazyMessage{data: data}
+	if err := scanMessage(data, &m.spans); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Bytes returns the encoded message. It must not be modified.
+func (m *LazyMessage) Bytes() []byte {
+	return m.data
+}
+
+func (m *LazyMessage) MarshalJSON() ([]byte, error) {
+	if m.data == nil {
+		return nil, errors.New("empty lazy message")
+	}
+	return m.data, nil
+}
+
+func (m *LazyMessage) UnmarshalJSON(data []byte) error {
+	data = bytes.Clone(data)
+	var spans messageSpans
+	if err := scanMessage(data, &spans); err != nil {
+		return err
+	}
+	m.data, m.spans = data, spans
+	return nil
+}
+
+func (m *LazyMessage) IsRequest() bool {
+	return m.spans.isRequest
+}
+
+func (m *LazyMessage) IsResponse() bool {
+	return m.spans.isResponse
+}
+
+// Kind classifies the message like Message.Kind does.
+func (m *LazyMessage) Kind() MessageKind {
+	return messageKind(m.spans.isRequest, m.spans.isResponse, m.spans.id.end == 0, m.spans.error.end != 0)
+}
+
+// ID returns the message ID, which is empty for notifications.
+func (m *LazyMessage) ID() RawID {
+	return RawID(m.spans.id.of(m.data))
+}
+
+// Method returns the method name, or an empty string if this is not a request.
+func (m *LazyMessage) Method() string {
+	method := m.spans.method.of(m.data)
+	if method == nil || isNull(method) {
+		return ""
+	}
+	return unquoteString(method)
+}
+
+// Params returns the raw params, as sub-slice of the message data.
+func (m *LazyMessage) Params() Params {
+	return Params(m.spans.params.of(m.data))
+}
+
+// Result returns the raw result, as sub-slice of the message data, which may be `null`.
+// Nil if there is no result.
+func (m *LazyMessage) Result() json.RawMessage {
+	return m.spans.result.of(m.data)
+}
+
+// ErrorObject decodes the error of the response, if any.
+func (m *LazyMessage) ErrorObject() (*ErrorObject, error) {
+	data := m.spans.error.of(m.data)
+	if data == nil {
+		return nil, nil
+	}
+	var out ErrorObject
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Message fully decodes the message.
+func (m *LazyMessage) Message() (*Message, error) {
+	var s ScannedMessage
+	if err := ScanMessage(m.data, &s); err != nil {
+		return nil, err
+	}
+	return s.Message()
+}
+
+// SetID replaces the message ID, e.g. when a proxy maps IDs between clients and backends.
+// Only the bytes of the ID are changed, or the ID member is appended if the message did not have one.
+func (m *LazyMessage) SetID(id RawID) error {
+	if id.IsNotification() {
+		return errors.New("cannot remove the ID of a message")
+	}
+	if !id.IsValid() {
+		return fmt.Errorf("invalid ID: %x", []byte(id))
+	}
+	return m.patch(m.spans.id, "id", []byte(id))
+}
+
+// SetMethod replaces the method of a request.
+func (m *LazyMessage) SetMethod(method string) error {
+	if !m.spans.isRequest {
+		return errors.New("cannot set the method of a response")
+	}
+	data, err := json.Marshal(method)
+	if err != nil {
+		return err
+	}
+	return m.patch(m.spans.method, "method", data)
+}
+
+// SetParams replaces the params of a request.
+func (m *LazyMessage) SetParams(params Params) error {
+	if !m.spans.isRequest {
+		return errors.New("cannot set the params of a response")
+	}
+	if len(params) == 0 || (params[0] != '[' && params[0] != '{') || !json.Valid(params) {
+		return errors.New("JSON-RPC params must be list or map")
+	}
+	return m.patch(m.spans.params, "params", params)
+}
+
+// patch replaces the value at the span with the given value,
+// or inserts a new member with the given key if the span is absent.
+// The message data is copied, the original data is not modified.
+func (m *LazyMessage) patch(sp span, key string, value []byte) error {
+	if m.data == nil {
+		return errors.New("empty lazy message")
+	}
+	var out []byte
+	if sp.end != 0 {
+		out = make([]byte, 0, len(m.data)-(sp.end-sp.start)+len(value))
+		out = append(out, m.data[:sp.start]...)
+		out = append(out, value...)
+		out = append(out, m.data[sp.end:]...)
+	} else {
+		closing := m.spans.object.end - 1
+		out = make([]byte, 0, len(m.data)+len(key)+len(value)+4)
+		out = append(out, m.data[:closing]...)
+		if m.spans.members > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, '"')
+		out = append(out, key...)
+		out = append(out, '"', ':')
+		out = append(out, value...)
+		out = append(out, m.data[closing:]...)
+	}
+	var spans messageSpans
+	if err := scanMessage(out, &spans); err != nil {
+		return fmt.Errorf("patched message is invalid: %w", err)
+	}
+	m.data, m.spans = out, spans
+	return nil
+}
@@ -0,0 +1,126 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLazyMessage(t *testing.T) {
+	const req = `{ "id" : 7,"method":"eth_call", "params": [{"to": "0xaa"}, "latest"], "x-trace": "abc" ,"jsonrpc":"2.0"}`
+	t.Run("passthrough", func(t *testing.T) {
+		m, err := ParseLazyMessage([]byte(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(m.Bytes()) != req {
+			t.Fatalf("expected original bytes, got %s", m.Bytes())
+		}
+		if !m.IsRequest() || m.IsResponse() {
+			t.Fatal("expected request")
+		}
+		if m.Method() != "eth_call" || m.ID() != "7" || string(m.Params()) != `[{"to": "0xaa"}, "latest"]` {
+			t.Fatal("unexpected members")
+		}
+	})
+	t.Run("patch ID", func(t *testing.T) {
+		m, err := ParseLazyMessage([]byte(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.SetID(`"proxy-123"`); err != nil {
+			t.Fatal(err)
+		}
+		const expected = `{ "id" : "proxy-123","method":"eth_call", "params": [{"to": "0xaa"}, "latest"], "x-trace": "abc" ,"jsonrpc":"2.0"}`
+		if string(m.Bytes()) != expected {
+			t.Fatalf("unexpected patched message: %s", m.Bytes())
+		}
+		if m.ID() != `"proxy-123"` {
+			t.Fatalf("unexpected ID: %s", m.ID())
+		}
+		if err := m.SetID("1.5"); err == nil {
+			t.Fatal("expected error for invalid ID")
+		}
+		if err := m.SetID(""); err == nil {
+			t.Fatal("expected error for removing ID")
+		}
+	})
+	t.Run("add ID to notification", func(t *testing.T) {
+		m, err := ParseLazyMessage([]byte(`{"jsonrpc": "2.0", "method": "update"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.SetID("1"); err != nil {
+			t.Fatal(err)
+		}
+		if string(m.Bytes()) != `{"jsonrpc": "2.0", "method": "update","id":1}` {
+			t.Fatalf("unexpected patched message: %s", m.Bytes())
+		}
+	})
+	t.Run("patch method and params", func(t *testing.T) {
+		m, err := ParseLazyMessage([]byte(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.SetMethod("eth_estimateGas"); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.SetParams(Params(`[{"to":"0xbb"}]`)); err != nil {
+			t.Fatal(err)
+		}
+		const expected = `{ "id" : 7,"method":"eth_estimateGas", "params": [{"to":"0xbb"}], "x-trace": "abc" ,"jsonrpc":"2.0"}`
+		if string(m.Bytes()) != expected {
+			t.Fatalf("unexpected patched message: %s", m.Bytes())
+		}
+		if err := m.SetParams(Params(`"x"`)); err == nil {
+			t.Fatal("expected error for invalid params")
+		}
+	})
+	t.Run("response", func(t *testing.T) {
+		m, err := ParseLazyMessage([]byte(`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "1"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.IsResponse() || m.Result() != nil {
+			t.Fatal("expected error response")
+		}
+		errObj, err := m.ErrorObject()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errObj.Code != MethodNotFound.Code() {
+			t.Fatalf("unexpected error: %+v", errObj)
+		}
+		if err := m.SetMethod("foo"); err == nil {
+			t.Fatal("expected error for setting method of response")
+		}
+		full, err := m.Message()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if full.ID != `"1"` || full.Error == nil || full.Error.Message != "Method not found" {
+			t.Fatal("unexpected decoded message")
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := ParseLazyMessage([]byte(`{"jsonrpc": "2.0"}`)); err == nil {
+			t.Fatal("expected error for invalid message")
+		}
+	})
+	t.Run("json", func(t *testing.T) {
+		var batch []*LazyMessage
+		if err := json.Unmarshal([]byte(`[`+req+`, {"jsonrpc": "2.0", "method": "update"}]`), &batch); err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) != 2 || batch[0].Method() != "eth_call" || batch[1].Method() != "update" {
+			t.Fatal("unexpected batch")
+		}
+		out, err := json.Marshal(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const expected = `[{"id":7,"method":"eth_call","params":[{"to":"0xaa"},"latest"],"x-trace":"abc","jsonrpc":"2.0"},{"jsonrpc":"2.0","method":"update"}]`
+		if string(out) != expected {
+			t.Fatalf("unexpected encoding: %s", out)
+		}
+	})
+}
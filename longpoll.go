@@ -0,0 +1,379 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLongPollQueueSize is how many notifications a session queues by default.
+	DefaultLongPollQueueSize = 256
+	// DefaultLongPollMaxWait is how long a poll waits for notifications at most by default.
+	DefaultLongPollMaxWait = 30 * time.Second
+	// DefaultLongPollSessionTimeout is how long an idle session is kept by default.
+	DefaultLongPollSessionTimeout = 2 * time.Minute
+)
+
+// NewSessionID is the session ID with which a POST request asks LongPollHandler to start a new session.
+const NewSessionID = "new"
+
+// ErrQueueFull is returned when notifying a long-polling client whose notification queue is full.
+var ErrQueueFull = errors.New("notification queue full")
+
+// LongPollOption configures NewLongPollHandler.
+type LongPollOption func(cfg *longPollConfig)
+
+type longPollConfig struct {
+	queueSize      int
+	maxWait        time.Duration
+	sessionTimeout time.Duration
+	maxBodySize    int64
+	serveOptions   []ServeOption
+}
+
+// LongPollQueueSize bounds the notifications queued per session, DefaultLongPollQueueSize by default.
+// Notifying a client with a full queue fails with ErrQueueFull.
+func LongPollQueueSize(n int) LongPollOption {
+	return func(cfg *longPollConfig) {
+		cfg.queueSize = n
+	}
+}
+
+// LongPollMaxWait limits how long a poll waits for notifications, DefaultLongPollMaxWait by default.
+// It is also the wait of polls that do not set a timeout.
+func LongPollMaxWait(d time.Duration) LongPollOption {
+	return func(cfg *longPollConfig) {
+		cfg.maxWait = d
+	}
+}
+
+// LongPollSessionTimeout sets how long a session is kept without requests or polls,
+// DefaultLongPollSessionTimeout by default.
+func LongPollSessionTimeout(d time.Duration) LongPollOption {
+	return func(cfg *longPollConfig) {
+		cfg.sessionTimeout = d
+	}
+}
+
+// LongPollMaxBodySize limits the size of POST request bodies, DefaultMaxBodySize by default.
+func LongPollMaxBodySize(n int64) LongPollOption {
+	return func(cfg *longPollConfig) {
+		cfg.maxBodySize = n
+	}
+}
+
+// LongPollServeOptions configures how the payload of each POST request is served, see Serve.
+func LongPollServeOptions(opts ...ServeOption) LongPollOption {
+	return func(cfg *longPollConfig) {
+		cfg.serveOptions = append(cfg.serveOptions, opts...)
+	}
+}
+
+// LongPollHandler serves JSON-RPC over plain HTTP requests, and delivers notifications by long-polling,
+// for clients behind proxies that break websockets and Server-Sent Events.
+//
+// Requests are sent by POST, and responded to like HTTPHandler does.
+// A POST without session is served without Notifier, like HTTPHandler does.
+// A POST with the session NewSessionID, in the SessionHeader header or "session" query parameter,
+// starts a new session, of which the ID is in the SessionHeader response header.
+// Handlers find the Notifier of the session in the request context, e.g. to notify subscriptions.
+// The context of a session request is cancelled when the session ends, not when the POST returns.
+//
+// Clients fetch notifications with GET requests with the session ID, in the SessionHeader header
+// or "session" query parameter. A poll responds with a JSON array of the queued notifications as soon as there are any,
+// or with an empty array when the "timeout" query parameter, e.g. "20s", or LongPollMaxWait, passes.
+// A DELETE request with the session ID ends the session.
+type LongPollHandler struct {
+	handler Handler
+	cfg     longPollConfig
+
+	mu       sync.Mutex
+	sessions map[string]*pollSession
+	closed   bool
+}
+
+var _ http.Handler = (*LongPollHandler)(nil)
+
+// NewLongPollHandler creates an http.Handler that serves the JSON-RPC handler with long-polling for notifications.
+func NewLongPollHandler(h Handler, opts ...LongPollOption) *LongPollHandler {
+	cfg := longPollConfig{
+		queueSize:      DefaultLongPollQueueSize,
+		maxWait:        DefaultLongPollMaxWait,
+		sessionTimeout: DefaultLongPollSessionTimeout,
+		maxBodySize:    DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &LongPollHandler{handler: h, cfg: cfg, sessions: make(map[string]*pollSession)}
+}
+
+func (s *LongPollHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.servePoll(w, r)
+	case http.MethodPost:
+		s.servePost(w, r)
+	case http.MethodDelete:
+		session, ok := s.requestSession(w, r)
+		if !ok {
+			return
+		}
+		session.close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Close ends all sessions. Pending polls return, and notifying the sessions fails with ErrPeerClosed.
+// New sessions cannot be started after Close.
+func (s *LongPollHandler) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	sessions := make([]*pollSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+	for _, session := range sessions {
+		session.close()
+	}
+	return nil
+}
+
+// requestSession returns the session of the request, or responds with an error and returns false.
+func (s *LongPollHandler) requestSession(w http.ResponseWriter, r *http.Request) (*pollSession, bool) {
+	id := requestSessionID(r)
+	if id == "" {
+		http.Error(w, "missing session", http.StatusBadRequest)
+		return nil, false
+	}
+	s.mu.Lock()
+	session := s.sessions[id]
+	s.mu.Unlock()
+	if session == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return nil, false
+	}
+	return session, true
+}
+
+func (s *LongPollHandler) servePost(w http.ResponseWriter, r *http.Request) {
+	if !isJSONContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "unsupported content type, JSON-RPC requires application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if !acceptsJSON(r.Header.Values("Accept")) {
+		http.Error(w, "not acceptable, JSON-RPC responds with application/json", http.StatusNotAcceptable)
+		return
+	}
+	ctx := r.Context()
+	if id := requestSessionID(r); id != "" {
+		var session *pollSession
+		if id == NewSessionID {
+			var err error
+			if session, err = s.newSession(); err != nil {
+				if errors.Is(err, ErrPeerClosed) {
+					err = errors.New("server closed")
+				}
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		} else {
+			var ok bool
+			if session, ok = s.requestSession(w, r); !ok {
+				return
+			}
+		}
+		session.begin()
+		defer session.end()
+		w.Header().Set(SessionHeader, session.id)
+		// handlers may use the context after the POST returns, e.g. for subscriptions
+		ctx = ContextWithNotifier(sessionContext{Context: session.ctx, values: ctx}, session)
+	}
+	body, ok := readBody(w, r, s.cfg.maxBodySize)
+	if !ok {
+		return
+	}
+	out := Serve(ctx, body, s.handler, s.cfg.serveOptions...)
+	if out == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *LongPollHandler) servePoll(w http.ResponseWriter, r *http.Request) {
+	wait := s.cfg.maxWait
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		wait = min(d, wait)
+	}
+	session, ok := s.requestSession(w, r)
+	if !ok {
+		return
+	}
+	session.begin()
+	defer session.end()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	var items [][]byte
+	for {
+		var wake <-chan struct{}
+		items, wake = session.take()
+		if len(items) > 0 {
+			break
+		}
+		select {
+		case <-wake:
+			continue
+		case <-timer.C:
+		case <-session.closed:
+		case <-r.Context().Done():
+			return
+		}
+		break
+	}
+	out := append(append([]byte{'['}, joinPayloads(items)...), ']')
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *LongPollHandler) newSession() (*pollSession, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &pollSession{
+		id:     id,
+		srv:    s,
+		ctx:    ctx,
+		cancel: cancel,
+		wake:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		cancel()
+		return nil, ErrPeerClosed
+	}
+	session.expiry = time.AfterFunc(s.cfg.sessionTimeout, session.close)
+	s.sessions[id] = session
+	return session, nil
+}
+
+// pollSession queues the notifications of a long-polling client.
+type pollSession struct {
+	id  string
+	srv *LongPollHandler
+	// cancelled when the session ends
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	queue [][]byte
+	// closed and replaced when a notification is queued
+	wake chan struct{}
+	// number of requests and polls in progress, the session does not expire while there are any
+	active int
+	expiry *time.Timer
+	closed chan struct{}
+	done   bool
+}
+
+var _ Notifier = (*pollSession)(nil)
+
+// Notify queues the notification until the client polls, or fails with ErrQueueFull.
+func (s *pollSession) Notify(ctx context.Context, method string, params any) error {
+	msg, err := NewNotification(method, params)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return ErrPeerClosed
+	}
+	if len(s.queue) >= s.srv.cfg.queueSize {
+		return ErrQueueFull
+	}
+	s.queue = append(s.queue, data)
+	close(s.wake)
+	s.wake = make(chan struct{})
+	return nil
+}
+
+// Closed is closed when the session ends.
+func (s *pollSession) Closed() <-chan struct{} {
+	return s.closed
+}
+
+// take dequeues all notifications, and returns a channel that is closed when the next one is queued.
+func (s *pollSession) take() ([][]byte, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.queue
+	s.queue = nil
+	return items, s.wake
+}
+
+// begin stops the expiry of the session, until the request ends.
+func (s *pollSession) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active++
+	s.expiry.Stop()
+}
+
+func (s *pollSession) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if s.active == 0 && !s.done {
+		s.expiry.Reset(s.srv.cfg.sessionTimeout)
+	}
+}
+
+// close ends the session, and cancels the context of its handlers.
+func (s *pollSession) close() {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	s.expiry.Stop()
+	s.queue = nil
+	close(s.closed)
+	s.mu.Unlock()
+	s.cancel()
+	s.srv.mu.Lock()
+	delete(s.srv.sessions, s.id)
+	s.srv.mu.Unlock()
+}
+
+// sessionContext is done when the session ends, and has the values of the request context.
+type sessionContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c sessionContext) Value(key any) any {
+	return c.values.Value(key)
+}
@@ -0,0 +1,276 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func longPollRequest(t *testing.T, method, url, session, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if session != "" {
+		req.Header.Set(SessionHeader, session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+func TestLongPoll(t *testing.T) {
+	notifiers := make(chan Notifier, 1)
+	subscribe := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		if req.Method != "subscribe" {
+			return specHandler(ctx, req)
+		}
+		n, ok := NotifierFromContext(ctx)
+		if !ok {
+			return req.RespondErr(ConstErrorObj(InternalError))
+		}
+		select {
+		case notifiers <- n:
+		default:
+		}
+		return req.Respond("0x1")
+	})
+	newServer := func(t *testing.T, opts ...LongPollOption) (*LongPollHandler, string) {
+		t.Helper()
+		h := NewLongPollHandler(subscribe, opts...)
+		srv := httptest.NewServer(h)
+		t.Cleanup(func() {
+			_ = h.Close()
+			srv.Close()
+		})
+		return h, srv.URL
+	}
+	subscribed := func(t *testing.T, url string) (string, Notifier) {
+		t.Helper()
+		resp, body := longPollRequest(t, http.MethodPost, url, NewSessionID, `{"jsonrpc":"2.0","method":"subscribe","id":1}`)
+		if resp.StatusCode != http.StatusOK || body != `{"result":"0x1","id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+		}
+		session := resp.Header.Get(SessionHeader)
+		if session == "" || session == NewSessionID {
+			t.Fatal("missing session")
+		}
+		return session, <-notifiers
+	}
+	// poll starts polling the session, and waits until the poll is pending
+	poll := func(t *testing.T, h *LongPollHandler, url, id string) <-chan string {
+		t.Helper()
+		h.mu.Lock()
+		session := h.sessions[id]
+		h.mu.Unlock()
+		polled := make(chan string, 1)
+		go func() {
+			resp, err := http.Get(url + "?session=" + id)
+			if err != nil {
+				polled <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			polled <- string(body)
+		}()
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			session.mu.Lock()
+			active := session.active
+			session.mu.Unlock()
+			if active > 0 {
+				return polled
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("poll did not start")
+			}
+		}
+	}
+
+	t.Run("call", func(t *testing.T) {
+		h, url := newServer(t)
+		resp, body := longPollRequest(t, http.MethodPost, url, "", `{"jsonrpc":"2.0","method":"subtract","params":[42,23],"id":1}`)
+		if resp.StatusCode != http.StatusOK || body != `{"result":19,"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+		}
+		// requests without session are stateless
+		if resp.Header.Get(SessionHeader) != "" {
+			t.Fatal("unexpected session for stateless request")
+		}
+		h.mu.Lock()
+		n := len(h.sessions)
+		h.mu.Unlock()
+		if n != 0 {
+			t.Fatalf("expected no sessions, got %d", n)
+		}
+		session, _ := subscribed(t, url)
+		resp, _ = longPollRequest(t, http.MethodPost, url, session, `{"jsonrpc":"2.0","method":"notify_hello","params":[7]}`)
+		if resp.StatusCode != http.StatusNoContent || resp.Header.Get(SessionHeader) != session {
+			t.Fatalf("unexpected response: %d %v", resp.StatusCode, resp.Header)
+		}
+	})
+	t.Run("poll", func(t *testing.T) {
+		h, url := newServer(t)
+		session, n := subscribed(t, url)
+		for i := 0; i < 2; i++ {
+			if err := n.Notify(context.Background(), "subscription", []int{i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		resp, body := longPollRequest(t, http.MethodGet, url+"?timeout=1s", session, "")
+		if resp.StatusCode != http.StatusOK || body != `[{"method":"subscription","params":[0],"jsonrpc":"2.0"},{"method":"subscription","params":[1],"jsonrpc":"2.0"}]` {
+			t.Fatalf("unexpected poll: %d %s", resp.StatusCode, body)
+		}
+		// a poll waits for the next notification
+		polled := poll(t, h, url, session)
+		if err := n.Notify(context.Background(), "subscription", []int{2}); err != nil {
+			t.Fatal(err)
+		}
+		if body = <-polled; body != `[{"method":"subscription","params":[2],"jsonrpc":"2.0"}]` {
+			t.Fatalf("unexpected poll: %s", body)
+		}
+		start := time.Now()
+		if _, body = longPollRequest(t, http.MethodGet, url+"?timeout=20ms", session, ""); body != `[]` {
+			t.Fatalf("unexpected poll: %s", body)
+		}
+		if time.Since(start) < 20*time.Millisecond {
+			t.Fatal("poll returned before timeout")
+		}
+	})
+	t.Run("subscription", func(t *testing.T) {
+		// the subscription notifies from the handler context, after the POST returns
+		trigger := make(chan struct{})
+		h := NewLongPollHandler(HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			n, _ := NotifierFromContext(ctx)
+			go func() {
+				select {
+				case <-trigger:
+					if ctx.Value(http.ServerContextKey) == nil {
+						return
+					}
+					_ = n.Notify(ctx, "subscription", []int{1})
+				case <-ctx.Done():
+				}
+			}()
+			return req.Respond("0x1")
+		}))
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+		defer h.Close()
+		resp, _ := longPollRequest(t, http.MethodPost, srv.URL, NewSessionID, `{"jsonrpc":"2.0","method":"subscribe","id":1}`)
+		session := resp.Header.Get(SessionHeader)
+		close(trigger)
+		if _, body := longPollRequest(t, http.MethodGet, srv.URL+"?timeout=5s", session, ""); body != `[{"method":"subscription","params":[1],"jsonrpc":"2.0"}]` {
+			t.Fatalf("unexpected poll: %s", body)
+		}
+	})
+	t.Run("max wait", func(t *testing.T) {
+		_, url := newServer(t, LongPollMaxWait(20*time.Millisecond))
+		session, _ := subscribed(t, url)
+		if _, body := longPollRequest(t, http.MethodGet, url+"?timeout=1h", session, ""); body != `[]` {
+			t.Fatalf("unexpected poll: %s", body)
+		}
+	})
+	t.Run("queue bound", func(t *testing.T) {
+		_, url := newServer(t, LongPollQueueSize(2))
+		session, n := subscribed(t, url)
+		for i := 0; i < 2; i++ {
+			if err := n.Notify(context.Background(), "subscription", []int{i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := n.Notify(context.Background(), "subscription", []int{2}); !errors.Is(err, ErrQueueFull) {
+			t.Fatalf("expected full queue, got %v", err)
+		}
+		longPollRequest(t, http.MethodGet, url, session, "")
+		if err := n.Notify(context.Background(), "subscription", []int{3}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("expiry", func(t *testing.T) {
+		_, url := newServer(t, LongPollSessionTimeout(50*time.Millisecond), LongPollMaxWait(100*time.Millisecond))
+		session, n := subscribed(t, url)
+		// polling keeps the session alive, even when polls take longer than the session timeout
+		for i := 0; i < 2; i++ {
+			if resp, _ := longPollRequest(t, http.MethodGet, url, session, ""); resp.StatusCode != http.StatusOK {
+				t.Fatalf("unexpected status: %d", resp.StatusCode)
+			}
+		}
+		select {
+		case <-n.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatal("session did not expire")
+		}
+		if err := n.Notify(context.Background(), "subscription", nil); !errors.Is(err, ErrPeerClosed) {
+			t.Fatalf("expected closed session, got %v", err)
+		}
+		if resp, _ := longPollRequest(t, http.MethodGet, url, session, ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected expired session, got %d", resp.StatusCode)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		h, url := newServer(t)
+		session, n := subscribed(t, url)
+		polled := poll(t, h, url, session)
+		if resp, _ := longPollRequest(t, http.MethodDelete, url, session, ""); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("unexpected status: %d", resp.StatusCode)
+		}
+		// the pending poll returns when the session ends
+		select {
+		case body := <-polled:
+			if body != `[]` {
+				t.Fatalf("unexpected poll: %s", body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("poll did not return")
+		}
+		<-n.Closed()
+	})
+	t.Run("closed", func(t *testing.T) {
+		h, url := newServer(t)
+		_, n := subscribed(t, url)
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+		<-n.Closed()
+		resp, _ := longPollRequest(t, http.MethodPost, url, NewSessionID, `{"jsonrpc":"2.0","method":"subscribe","id":1}`)
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected no new sessions after close, got %d", resp.StatusCode)
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		_, url := newServer(t)
+		if resp, _ := longPollRequest(t, http.MethodGet, url, "", ""); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected bad request, got %d", resp.StatusCode)
+		}
+		if resp, _ := longPollRequest(t, http.MethodGet, url, "unknown", ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected not found, got %d", resp.StatusCode)
+		}
+		if resp, _ := longPollRequest(t, http.MethodPost, url, "unknown", `{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}`); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected not found, got %d", resp.StatusCode)
+		}
+		session, _ := subscribed(t, url)
+		if resp, _ := longPollRequest(t, http.MethodGet, url+"?timeout=soon", session, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected bad request, got %d", resp.StatusCode)
+		}
+		if resp, _ := longPollRequest(t, http.MethodPut, url, session, ""); resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("expected method not allowed, got %d", resp.StatusCode)
+		}
+	})
+}
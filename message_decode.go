@@ -0,0 +1,172 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// MessageOption configures DecodeMessage.
+type MessageOption func(cfg *messageConfig)
+
+type messageConfig struct {
+	rejectUnknownMembers bool
+	strictJSON           bool
+	lenientResponses     bool
+}
+
+// RejectUnknownMembers rejects messages with non-standard top-level members,
+// instead of preserving them as Extensions.
+func RejectUnknownMembers() MessageOption {
+	return func(cfg *messageConfig) {
+		cfg.rejectUnknownMembers = true
+	}
+}
+
+// LenientResponses normalizes malformed responses of buggy servers, instead of rejecting them:
+// a `"error": null` member is ignored, and if both result and error are present, the error is used.
+func LenientResponses() MessageOption {
+	return func(cfg *messageConfig) {
+		cfg.lenientResponses = true
+	}
+}
+
+// DecodeMessage decodes a single message, like Message.UnmarshalJSON, but with options.
+// Invalid messages result in a MessageError, with ParseErr or InvalidRequest as code.
+func DecodeMessage(data []byte, opts ...MessageOption) (*Message, error) {
+	var cfg messageConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var m Message
+	if err := m.decode(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *Message) decode(data []byte, cfg *messageConfig) error {
+	if cfg.strictJSON {
+		if err := checkStrictJSON(data); err != nil {
+			return err
+		}
+	}
+	var dest jsonMessage
+	if err := json.Unmarshal(data, &dest); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return asMessageError(err, ParseErr)
+		}
+		return asMessageError(err, InvalidRequest)
+	}
+	if err := dest.Check(); err != nil {
+		return err
+	}
+	if dest.Response != nil {
+		result, errObj, err := responseMembers(data)
+		if err != nil {
+			return err
+		}
+		useResult, useError, err := checkResponse(result, errObj, cfg.lenientResponses)
+		if err != nil {
+			return err
+		}
+		if !useError {
+			dest.Error = nil
+		}
+		if !useResult {
+			dest.Result = nil
+		} else if dest.Result == nil { // null result
+			r := json.RawMessage("null")
+			dest.Result = &r
+		}
+	}
+	ext, err := extensions(data)
+	if err != nil {
+		return err
+	}
+	if cfg.rejectUnknownMembers {
+		for k := range ext {
+			return invalidRequest(fmt.Errorf("unknown member %q", k))
+		}
+	}
+	*m = Message{
+		Request:    dest.Request,
+		Response:   dest.Response,
+		ID:         dest.ID,
+		Extensions: ext,
+	}
+	return nil
+}
+
+// responseMembers returns the raw result and error members of the JSON object data, nil if absent.
+// Like encoding/json, keys match case-insensitively, and the last duplicate wins.
+func responseMembers(data []byte) (result, errObj []byte, err error) {
+	start := scanSpace(data, 0)
+	_, err = scanObject(data, start, 1, func(keyStart, keyEnd, start, end int) bool {
+		switch messageMember(data[keyStart:keyEnd]) {
+		case memberResult:
+			result = data[start:end]
+		case memberError:
+			errObj = data[start:end]
+		}
+		return true
+	})
+	return result, errObj, err
+}
+
+// extensions collects the non-standard members of the JSON object data, nil if there are none.
+// Values are copied from the data.
+func extensions(data []byte) (out map[string]json.RawMessage, err error) {
+	start := scanSpace(data, 0)
+	if start >= len(data) || data[start] != '{' {
+		return nil, nil
+	}
+	_, err = scanObject(data, start, 1, func(keyStart, keyEnd, start, end int) bool {
+		key := data[keyStart:keyEnd]
+		if messageMember(key) != memberUnknown {
+			return true
+		}
+		if out == nil {
+			out = make(map[string]json.RawMessage)
+		}
+		out[unquoteString(key)] = bytes.Clone(data[start:end])
+		return true
+	})
+	return out, err
+}
+
+// appendExtensions adds the extension members to the encoded JSON object, in sorted key order.
+func appendExtensions(data []byte, ext map[string]json.RawMessage) ([]byte, error) {
+	if len(ext) == 0 {
+		return data, nil
+	}
+	keys := make([]string, 0, len(ext))
+	for k := range ext {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	out := data[:len(data)-1] // without closing brace
+	for _, k := range keys {
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		if messageMember(key) != memberUnknown {
+			return nil, fmt.Errorf("extension %q conflicts with a standard member", k)
+		}
+		v := ext[k]
+		if !json.Valid(v) {
+			return nil, fmt.Errorf("extension %q is not valid JSON", k)
+		}
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		out = append(out, key...)
+		out = append(out, ':')
+		out = append(out, v...)
+	}
+	return append(out, '}'), nil
+}
@@ -0,0 +1,310 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ScannedMessage holds the members of a JSON-RPC message, as found by ScanMessage.
+// Raw members are sub-slices of the scanned payload, and nil if the member is absent.
+type ScannedMessage struct {
+	// ID is the raw JSON id, e.g. `1`, `"abc"` or `null`. Nil for notifications.
+	ID []byte
+	// Method is the unquoted method name.
+	// It is a copy, instead of a sub-slice, only if the JSON string has escape sequences or invalid UTF-8.
+	Method []byte
+	// Params is the raw JSON params, a list or map.
+	Params []byte
+	// Result is the raw JSON result, which may be `null`.
+	Result []byte
+	// Error is the raw JSON error object.
+	Error []byte
+	// IsRequest is true if the message has a method or params member.
+	IsRequest bool
+	// IsResponse is true if the message has a result or error member.
+	IsResponse bool
+	// the scanned payload, to collect extensions from
+	data []byte
+}
+
+// ScanMessage scans a single JSON-RPC message, without reflection and without allocating,
+// for proxies that only need to inspect a few members.
+// It accepts and rejects the same messages as Message.UnmarshalJSON does, with the same MessageError codes.
+func ScanMessage(data []byte, out *ScannedMessage) error {
+	var spans messageSpans
+	if err := scanMessage(data, &spans); err != nil {
+		return err
+	}
+	*out = ScannedMessage{
+		ID:         spans.id.of(data),
+		Params:     spans.params.of(data),
+		Result:     spans.result.of(data),
+		Error:      spans.error.of(data),
+		IsRequest:  spans.isRequest,
+		IsResponse: spans.isResponse,
+		data:       data,
+	}
+	if method := spans.method.of(data); method != nil && method[0] == '"' {
+		raw := method[1 : len(method)-1]
+		if bytes.IndexByte(raw, '\\') < 0 && utf8.Valid(raw) {
+			out.Method = raw
+		} else {
+			out.Method = []byte(unquoteString(method))
+		}
+	}
+	return nil
+}
+
+// Message converts the scanned members into a Message, copying the raw members.
+// Non-standard members are included as Extensions.
+func (s *ScannedMessage) Message() (*Message, error) {
+	ext, err := extensions(s.data)
+	if err != nil {
+		return nil, err
+	}
+	m := &Message{ID: RawID(s.ID), Extensions: ext}
+	if s.IsRequest {
+		m.Request = &Request{
+			Method: string(s.Method),
+			Params: Params(bytes.Clone(s.Params)),
+		}
+	}
+	if s.IsResponse {
+		m.Response = &Response{}
+		if s.Result != nil {
+			result := json.RawMessage(bytes.Clone(s.Result))
+			m.Result = &result
+		}
+		if s.Error != nil {
+			m.Error = new(ErrorObject)
+			if err := json.Unmarshal(s.Error, m.Error); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// span is a range of bytes in a payload. The zero span is absent: JSON values cannot end at offset 0.
+type span struct {
+	start, end int
+}
+
+func (s span) of(data []byte) []byte {
+	if s.end == 0 {
+		return nil
+	}
+	return data[s.start:s.end]
+}
+
+type messageSpans struct {
+	version, id, method, params, result, error span
+	isRequest, isResponse                      bool
+	// the object, including braces
+	object span
+	// number of members in the object, including unknown members
+	members int
+}
+
+const (
+	memberUnknown = iota
+	memberVersion
+	memberID
+	memberMethod
+	memberParams
+	memberResult
+	memberError
+)
+
+// messageMember identifies the message member by JSON key (including quotes).
+// Like encoding/json, keys are matched case-insensitively.
+func messageMember(key []byte) int {
+	switch {
+	case matchKey(key, "jsonrpc"):
+		return memberVersion
+	case matchKey(key, "id"):
+		return memberID
+	case matchKey(key, "method"):
+		return memberMethod
+	case matchKey(key, "params"):
+		return memberParams
+	case matchKey(key, "result"):
+		return memberResult
+	case matchKey(key, "error"):
+		return memberError
+	default:
+		return memberUnknown
+	}
+}
+
+// matchKey checks if the JSON key (including quotes) equals the name case-insensitively.
+// It only allocates if the key has escape sequences.
+func matchKey(key []byte, name string) bool {
+	raw := key[1 : len(key)-1]
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return bytes.EqualFold(raw, []byte(name))
+	}
+	return strings.EqualFold(unquoteString(key), name)
+}
+
+func isNull(v []byte) bool {
+	return len(v) == 4 && string(v) == "null"
+}
+
+// scanMessage scans the members of a JSON-RPC message, and checks them like Message.UnmarshalJSON does.
+// Like encoding/json, unknown members are ignored, and the last of duplicate members is used.
+func scanMessage(data []byte, out *messageSpans) error {
+	i := scanSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		if _, err := scanValue(data, i); err != nil {
+			return asMessageError(err, ParseErr)
+		}
+		return invalidRequest(errors.New("message must be a JSON object"))
+	}
+	var memberErr error
+	end, err := scanObject(data, i, 1, func(keyStart, keyEnd, start, end int) bool {
+		v := data[start:end]
+		sp := span{start: start, end: end}
+		out.members++
+		switch messageMember(data[keyStart:keyEnd]) {
+		case memberVersion:
+			if !isNull(v) && (v[0] != '"' || !stringEquals(v, "2.0")) {
+				memberErr = fmt.Errorf("invalid JSON RPC version: %s", v)
+				return false
+			}
+			out.version = sp
+		case memberID:
+			if !isNull(v) && !validRawID(v) {
+				memberErr = fmt.Errorf("invalid ID: %x", v)
+				return false
+			}
+			out.id = sp
+		case memberMethod:
+			if !isNull(v) && v[0] != '"' {
+				memberErr = errors.New("method must be a string")
+				return false
+			}
+			out.method = sp
+			out.isRequest = true
+		case memberParams:
+			if v[0] != '[' && v[0] != '{' {
+				memberErr = errors.New("JSON-RPC params must be list or map")
+				return false
+			}
+			out.params = sp
+			out.isRequest = true
+		case memberResult:
+			out.result = sp
+			out.isResponse = true
+		case memberError:
+			if err := checkErrorObject(v); err != nil {
+				memberErr = err
+				return false
+			}
+			out.error = sp
+			out.isResponse = true
+		}
+		return true
+	})
+	if err != nil {
+		return asMessageError(err, ParseErr)
+	}
+	if memberErr != nil {
+		// syntax errors take precedence, like encoding/json checks the syntax before decoding
+		if _, err := scanValue(data, i); err != nil {
+			return asMessageError(err, ParseErr)
+		}
+		return invalidRequest(memberErr)
+	}
+	if scanSpace(data, end) != len(data) {
+		return asMessageError(scanSyntaxErr(data, scanSpace(data, end), "after top-level value"), ParseErr)
+	}
+	out.object = span{start: i, end: end}
+	if err := checkMessage(out.isRequest, out.isResponse, out.id.end == 0); err != nil {
+		return err
+	}
+	if out.isResponse {
+		if _, _, err := checkResponse(out.result.of(data), out.error.of(data), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validRawID checks the raw JSON id value like RawID.IsValid, without allocating.
+// The value must be valid JSON.
+func validRawID(v []byte) bool {
+	if len(v) > maxIDLength {
+		return false
+	}
+	if v[0] == '"' {
+		return true
+	}
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkErrorObject checks the raw JSON error value like decoding it into an ErrorObject does.
+// The value must be valid JSON.
+func checkErrorObject(v []byte) error {
+	if isNull(v) {
+		return nil
+	}
+	if v[0] != '{' {
+		return errors.New("error must be an object")
+	}
+	var memberErr error
+	_, err := scanObject(v, 0, 1, func(keyStart, keyEnd, start, end int) bool {
+		key, value := v[keyStart:keyEnd], v[start:end]
+		switch {
+		case matchKey(key, "code"):
+			if !isNull(value) && !validInt64(value) {
+				memberErr = fmt.Errorf("error code must be an integer: %s", value)
+			}
+		case matchKey(key, "message"):
+			if !isNull(value) && value[0] != '"' {
+				memberErr = errors.New("error message must be a string")
+			}
+		}
+		return memberErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return memberErr
+}
+
+// validInt64 checks if the JSON number fits in an int64.
+func validInt64(v []byte) bool {
+	neg := v[0] == '-'
+	if neg {
+		v = v[1:]
+	}
+	if len(v) == 0 {
+		return false
+	}
+	limit := uint64(1<<63 - 1)
+	if neg {
+		limit++
+	}
+	var x uint64
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := uint64(c - '0')
+		if x > (limit-d)/10 {
+			return false
+		}
+		x = x*10 + d
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+var messageCorpus = []string{
+	`{"jsonrpc": "2.0", "method": "subtract", "params": [42,23], "id": 1}`,
+	`{"jsonrpc": "2.0", "result": 19, "id": 1}`,
+	`{"jsonrpc": "2.0", "method": "subtract", "params": {"subtrahend":23,"minuend":42}, "id": 3}`,
+	`{"jsonrpc": "2.0", "method": "update", "params": [1,2,3,4,5]}`,
+	`{"jsonrpc": "2.0", "method": "foobar", "id": "1"}`,
+	`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "1"}`,
+	`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`,
+	`{"jsonrpc": "2.0", "method": "foobar, "params": "bar", "baz]`,
+	`{"jsonrpc": "2.0", "method": 1, "params": "bar"}`,
+	`{"jsonrpc": "2.0", "method": "foobar", "params": "bar"}`,
+	`{"jsonrpc": "1.0", "method": "foobar", "params": []}`,
+	`{"jsonrpc": "2.0"}`,
+	`{"method":"a"}`,
+	`{"jsonrpc":null,"method":"a"}`,
+	`{"jsonrpc":2.0,"method":"a"}`,
+	`{"jsonrpc":"2\u002e0","method":"a"}`,
+	`{"jsonrpc":"2.0","method":null}`,
+	`{"jsonrpc":"2.0","params":[]}`,
+	`{"jsonrpc":"2.0","method":"a","params":null}`,
+	`{"jsonrpc":"2.0","result":null,"id":1}`,
+	`{"jsonrpc":"2.0","error":null,"id":1}`,
+	`{"jsonrpc":"2.0","result":null}`,
+	`{"jsonrpc":"2.0","method":"a","id":null}`,
+	`{"jsonrpc":"2.0","method":"a","id":1.5}`,
+	`{"jsonrpc":"2.0","method":"a","id":-1}`,
+	`{"jsonrpc":"2.0","method":"a","id":true}`,
+	`{"jsonrpc":"2.0","method":"a","id":" 1"}`,
+	`{"jsonrpc":"2.0","method":"a","id":"0x0000000000000000000000000000000000000000000000000000000000000000"}`,
+	`{"jsonrpc":"2.0","method":"a","id":"0x00000000000000000000000000000000000000000000000000000000000000000"}`,
+	`{"jsonrpc":"2.0","METHOD":"a","Id":1}`,
+	`{"jsonrpc":"2.0","method":"a","method":"b"}`,
+	`{"jsonrpc":"2.0","m\u0065thod":"esc\u0061ped"}`,
+	`{"jsonrpc":"2.0","error":{"code":"x","message":"m"},"id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":1.5,"message":"m"},"id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":1e3,"message":"m"},"id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":9223372036854775808,"message":"m"},"id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":-9223372036854775808,"message":"m"},"id":1}`,
+	`{"jsonrpc":"2.0","error":{"message":"m"},"id":1}`,
+	`{"jsonrpc":"2.0","error":{},"id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":1,"message":null,"data":null},"id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":1,"message":2},"id":1}`,
+	`{"jsonrpc":"2.0","error":"x","id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":1,"message":"m","data":{"x":1}},"id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":-1,"message":"m","Code":5},"id":1}`,
+	`{"jsonrpc":"2.0","method":"a","result":1,"id":1}`,
+	`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"x"},"result":null}`,
+	`{"jsonrpc":"2.0","method":"a","id":null,"x":1}`,
+	`{"jsonrpc":"2.0","method":"a","id":01}`,
+	`{"jsonrpc":"2.0","method":"a"} x`,
+	` {"jsonrpc":"2.0","method":"a"} `,
+	`null`,
+	`[]`,
+	`"x"`,
+	``,
+}
+
+func TestScanMessage(t *testing.T) {
+	for _, c := range messageCorpus {
+		checkScanMessage(t, []byte(c))
+	}
+}
+
+func FuzzScanMessage(f *testing.F) {
+	for _, c := range messageCorpus {
+		f.Add([]byte(c))
+	}
+	f.Fuzz(checkScanMessage)
+}
+
+// checkScanMessage checks that ScanMessage is equivalent to Message.UnmarshalJSON
+func checkScanMessage(t *testing.T, data []byte) {
+	var expected Message
+	expectedErr := json.Unmarshal(data, &expected)
+	var s ScannedMessage
+	err := ScanMessage(data, &s)
+	if (err == nil) != (expectedErr == nil) {
+		t.Fatalf("different outcome for %q: scan err: %v, unmarshal err: %v", data, err, expectedErr)
+	}
+	if err != nil {
+		return
+	}
+	got, err := s.Message()
+	if err != nil {
+		t.Fatalf("failed to convert scanned message %q: %v", data, err)
+	}
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("failed to encode scanned message: %v", err)
+	}
+	expectedJSON, err := json.Marshal(&expected)
+	if err != nil {
+		t.Fatalf("failed to encode decoded message: %v", err)
+	}
+	if !bytes.Equal(gotJSON, expectedJSON) {
+		t.Fatalf("different message for %q:\nscanned: %s\ndecoded: %s", data, gotJSON, expectedJSON)
+	}
+}
+
+func TestScanMessageAllocs(t *testing.T) {
+	data := []byte(`{"jsonrpc": "2.0", "method": "eth_getBlockByNumber", "params": ["0x1", false], "id": 1}`)
+	var s ScannedMessage
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := ScanMessage(data, &s); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %f", allocs)
+	}
+	if string(s.Method) != "eth_getBlockByNumber" || string(s.ID) != "1" || string(s.Params) != `["0x1", false]` {
+		t.Fatalf("unexpected scan result: %+v", s)
+	}
+}
+
+var benchMessages = map[string][]byte{
+	"request":  []byte(`{"jsonrpc": "2.0", "method": "eth_getBlockByNumber", "params": ["0x1", false], "id": 1}`),
+	"response": []byte(`{"jsonrpc": "2.0", "id": 1, "result": {"number": "0x1", "hash": "0x88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cb6", "transactions": ["0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060", "0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22061", "0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22062"], "logsBloom": "0x00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"}}`),
+	"error":    []byte(`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "1"}`),
+}
+
+func BenchmarkScanMessage(b *testing.B) {
+	for name, data := range benchMessages {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			var s ScannedMessage
+			for i := 0; i < b.N; i++ {
+				if err := ScanMessage(data, &s); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMessageUnmarshalJSON(b *testing.B) {
+	for name, data := range benchMessages {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				var m Message
+				if err := json.Unmarshal(data, &m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
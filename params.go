@@ -5,12 +5,176 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"reflect"
 )
 
-var emptyStruct = reflect.TypeFor[struct{}]()
+var (
+	emptyStruct     = reflect.TypeFor[struct{}]()
+	paramsType      = reflect.TypeFor[Params]()
+	rawMessageType  = reflect.TypeFor[json.RawMessage]()
+	unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	marshalerType   = reflect.TypeFor[json.Marshaler]()
+)
+
+// NumberMode determines how JSON numbers are decoded into interface values.
+type NumberMode uint8
+
+const (
+	// JSONNumbers decodes numbers as json.Number, without loss of precision.
+	JSONNumbers NumberMode = iota
+	// Float64Numbers decodes numbers as float64, like encoding/json does by default.
+	Float64Numbers
+	// BigIntNumbers decodes numbers as *big.Int, and rejects numbers that are not integers.
+	BigIntNumbers
+)
+
+// DecoderOption configures a ParamsDecoder.
+type DecoderOption func(cfg *decoderConfig)
+
+type decoderConfig struct {
+	disallowUnknownFields bool
+	caseSensitive         bool
+	disallowNull          bool
+	requireNamed          bool
+	numbers               NumberMode
+	validationCode        ErrorConst
+}
+
+// DisallowUnknownFields rejects named params, and keys in nested objects, that do not match any struct field.
+func DisallowUnknownFields() DecoderOption {
+	return func(cfg *decoderConfig) {
+		cfg.disallowUnknownFields = true
+	}
+}
+
+// CaseSensitive only matches named params that exactly match the name of a struct field,
+// instead of falling back to case-insensitive matching like encoding/json does.
+// It only applies to the params themselves: keys of nested objects are matched by encoding/json.
+func CaseSensitive() DecoderOption {
+	return func(cfg *decoderConfig) {
+		cfg.caseSensitive = true
+	}
+}
+
+// DisallowNull rejects null values for struct fields that are not a pointer or interface.
+// It only applies to the params themselves: nested null values are accepted, like encoding/json does.
+func DisallowNull() DecoderOption {
+	return func(cfg *decoderConfig) {
+		cfg.disallowNull = true
+	}
+}
+
+// RequireNamedParams rejects named params that omit a struct field that is not optional, like positional params do.
+// By default, omitted fields are left as they are, like encoding/json does.
+func RequireNamedParams() DecoderOption {
+	return func(cfg *decoderConfig) {
+		cfg.requireNamed = true
+	}
+}
+
+// Numbers sets how JSON numbers are decoded into interface values. JSONNumbers is the default.
+func Numbers(mode NumberMode) DecoderOption {
+	return func(cfg *decoderConfig) {
+		cfg.numbers = mode
+	}
+}
+
+// ValidationErrorCode sets the error code of the ParamsError returned when decoded params fail validation,
+// e.g. InvalidInput. By default, InvalidParams is used, the same as for params that fail to decode.
+func ValidationErrorCode(code ErrorConst) DecoderOption {
+	return func(cfg *decoderConfig) {
+		cfg.validationCode = code
+	}
+}
 
-func ParamsDecoder[E any]() func(p Params) (E, error) {
+// unmarshal decodes the JSON data into dest, which must be a pointer.
+func (cfg *decoderConfig) unmarshal(data []byte, dest any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if cfg.numbers != Float64Numbers {
+		dec.UseNumber()
+	}
+	if cfg.disallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(dest); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	if cfg.numbers == BigIntNumbers {
+		return toBigInts(reflect.ValueOf(dest))
+	}
+	return nil
+}
+
+// toBigInts replaces all json.Number values held by interface values with *big.Int values.
+func toBigInts(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if n, ok := v.Elem().Interface().(json.Number); ok {
+			x, ok := new(big.Int).SetString(string(n), 10)
+			if !ok {
+				return fmt.Errorf("number %s is not an integer", n)
+			}
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(x))
+			}
+			return nil
+		}
+		return toBigInts(v.Elem())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return toBigInts(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				if err := toBigInts(v.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := toBigInts(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// map values are not addressable, so convert a copy and put it back
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := toBigInts(elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+	return nil
+}
+
+// ParamsDecoder creates a function to decode params into E.
+// Structs can be decoded from both positional and named params,
+// and support the "param" struct tag, to control positions, optional params and defaults.
+// Struct types that implement json.Unmarshaler decode named params with their own UnmarshalJSON method.
+// Decoding is lenient by default, options can make it strict.
+// After decoding, the Validator interface and "validate" struct tags are checked,
+// throughout the decoded value.
+// Invalid params result in a *ParamsError.
+func ParamsDecoder[E any](opts ...DecoderOption) func(p Params) (E, error) {
+	cfg := &decoderConfig{validationCode: InvalidParams}
+	for _, opt := range opts {
+		opt(cfg)
+	}
 	typ := reflect.TypeFor[E]()
 	kind := typ.Kind()
 	pointerTo := false
@@ -18,15 +182,61 @@ func ParamsDecoder[E any]() func(p Params) (E, error) {
 		kind = typ.Elem().Kind()
 		pointerTo = true
 	}
+	var layout *paramsLayout
+	var layoutErr error
+	valueTyp := typ
+	customNamed := false
+	if kind == reflect.Struct {
+		if pointerTo {
+			valueTyp = typ.Elem()
+		}
+		layout, layoutErr = structLayout(valueTyp)
+		customNamed = reflect.PointerTo(valueTyp).Implements(unmarshalerType)
+	}
+	var validation *typeValidation
+	var validationErr error
+	if layout != nil {
+		validation, validationErr = paramsValidation(valueTyp, layout)
+	} else {
+		validation, validationErr = validationOf(valueTyp)
+	}
+	if layoutErr == nil && validationErr != nil {
+		layoutErr = fmt.Errorf("invalid params type %s: %w", typ, validationErr)
+	}
 	return func(p Params) (dest E, err error) {
+		if layoutErr != nil {
+			err = layoutErr
+			return
+		}
+		defer func() {
+			if err != nil {
+				err = asParamsError(err, p, typ)
+				return
+			}
+			if validation == nil {
+				return
+			}
+			v := reflect.ValueOf(&dest).Elem()
+			if layout != nil && pointerTo {
+				v = v.Elem()
+			}
+			if errs := validation.validateParams(v, len(p) > 0 && p[0] == '{'); len(errs) > 0 {
+				err = &ParamsError{Code: cfg.validationCode, Params: errs}
+			}
+		}()
 		p = bytes.TrimLeft(p, "\t\n\r ")
 		if len(p) == 0 {
 			// params may be omitted if we are not decoding into anything
 			if typ == emptyStruct {
 				return
 			}
-			err = errors.New("empty params data")
-			return
+			// or if all params are optional
+			if layout != nil && layout.required == 0 {
+				p = Params("[]")
+			} else {
+				err = errors.New("empty params data")
+				return
+			}
 		}
 		switch kind {
 		case reflect.Slice:
@@ -35,47 +245,123 @@ func ParamsDecoder[E any]() func(p Params) (E, error) {
 				err = fmt.Errorf("cannot decode named RPC params into list")
 				return
 			case '[':
-				dec := json.NewDecoder(bytes.NewReader(p))
-				dec.UseNumber()
-				err = dec.Decode(&dest)
+				err = cfg.unmarshal(p, &dest)
 				return
 			default:
 				err = errors.New("invalid params")
 				return
 			}
 		case reflect.Struct:
-			switch p[0] {
-			case '{':
-				err = json.Unmarshal(p, &dest)
+			if p[0] != '{' && p[0] != '[' {
+				err = errors.New("invalid params")
 				return
-			case '[':
-				var items []json.RawMessage
-				err = json.Unmarshal(p, &items)
-				if err != nil {
-					return
-				}
-				v := reflect.ValueOf(&dest).Elem()
-				if pointerTo { // allocate a value if the dest is just a pointer type
-					v.Set(reflect.New(typ.Elem()))
-					v = v.Elem()
-				}
-				if expected := v.NumField(); expected != len(items) {
-					err = fmt.Errorf("expected %d params, got %d params", expected, len(items))
-					return
-				}
-				for i, itemData := range items {
-					if fErr := json.Unmarshal(itemData, v.Field(i).Addr().Interface()); fErr != nil {
-						err = errors.Join(err, fmt.Errorf("failed to decode field %d: %w", i, fErr))
-					}
+			}
+			v := reflect.ValueOf(&dest).Elem()
+			if pointerTo { // allocate a value if the dest is just a pointer type
+				v.Set(reflect.New(typ.Elem()))
+				v = v.Elem()
+			}
+			if p[0] == '{' {
+				if customNamed {
+					err = cfg.unmarshal(p, v.Addr().Interface())
+				} else {
+					err = layout.decodeNamed(cfg, p, v)
 				}
 				return
-			default:
-				err = errors.New("invalid params")
+			}
+			var items []json.RawMessage
+			err = json.Unmarshal(p, &items)
+			if err != nil {
 				return
 			}
+			err = layout.decodePositional(cfg, items, v)
+			return
 		default:
-			err = json.Unmarshal(p, &dest)
+			err = cfg.unmarshal(p, &dest)
 			return
 		}
 	}
 }
+
+// EncoderOption configures a ParamsEncoder.
+type EncoderOption func(cfg *encoderConfig)
+
+type encoderConfig struct {
+	named bool
+}
+
+// NamedParams encodes structs as named params (a JSON object, keyed by the json struct tag names),
+// instead of positional params.
+func NamedParams() EncoderOption {
+	return func(cfg *encoderConfig) {
+		cfg.named = true
+	}
+}
+
+// ParamsEncoder is the inverse of ParamsDecoder.
+// Structs are encoded as positional params, as a list in the same order as the decoder expects,
+// unless the NamedParams option is used. Trailing optional fields without a default are omitted if they are zero.
+// Struct types that implement json.Marshaler encode named params with their own MarshalJSON method.
+// Slices and arrays are always positional, maps are always named.
+// Nil values and empty structs encode to empty params, which are omitted from requests.
+func ParamsEncoder[E any](opts ...EncoderOption) func(v E) (Params, error) {
+	var cfg encoderConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(v E) (Params, error) {
+		return cfg.encode(reflect.ValueOf(&v).Elem())
+	}
+}
+
+func (cfg *encoderConfig) encode(v reflect.Value) (Params, error) {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	var out []byte
+	switch typ := v.Type(); {
+	case typ == paramsType || typ == rawMessageType:
+		out = bytes.TrimLeft(v.Bytes(), "\t\n\r ")
+		if len(out) == 0 {
+			return nil, nil
+		}
+	case typ == emptyStruct:
+		return nil, nil
+	case typ.Kind() == reflect.Struct:
+		layout, err := structLayout(typ)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.named && (typ.Implements(marshalerType) || v.CanAddr() && reflect.PointerTo(typ).Implements(marshalerType)) {
+			if v.CanAddr() {
+				v = v.Addr()
+			}
+			out, err = json.Marshal(v.Interface())
+		} else if cfg.named {
+			out, err = layout.encodeNamed(v)
+		} else {
+			out, err = layout.encodePositional(v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case typ.Kind() == reflect.Slice && v.IsNil():
+		out = []byte("[]")
+	default:
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		out = data
+	}
+	if out[0] != '[' && out[0] != '{' {
+		return nil, fmt.Errorf("cannot encode %s as RPC params, must be list or map", v.Type())
+	}
+	return Params(out), nil
+}
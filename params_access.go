@@ -0,0 +1,140 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"iter"
+)
+
+// The accessors below scan the params without decoding them.
+// Returned values are sub-slices of the params data, not copies.
+// Invalid params, including truncated params, are treated as empty: accessors do not return errors.
+
+// IsPositional checks if the params are a list.
+func (p Params) IsPositional() bool {
+	i := scanSpace(p, 0)
+	return i < len(p) && p[i] == '['
+}
+
+// IsNamed checks if the params are a map.
+func (p Params) IsNamed() bool {
+	i := scanSpace(p, 0)
+	return i < len(p) && p[i] == '{'
+}
+
+// Len returns the number of params, or 0 if the params are invalid.
+func (p Params) Len() int {
+	i := scanSpace(p, 0)
+	if i >= len(p) {
+		return 0
+	}
+	n := 0
+	var end int
+	var err error
+	switch p[i] {
+	case '[':
+		end, err = scanArray(p, i, 1, func(start, end int) bool {
+			n++
+			return true
+		})
+	case '{':
+		end, err = scanObject(p, i, 1, func(keyStart, keyEnd, start, end int) bool {
+			n++
+			return true
+		})
+	default:
+		return 0
+	}
+	if err != nil || scanSpace(p, end) != len(p) {
+		return 0
+	}
+	return n
+}
+
+// At returns the positional param at index i.
+// It returns false if the params are not positional, or if there is no param at that index.
+func (p Params) At(i int) (json.RawMessage, bool) {
+	if !p.valid() {
+		return nil, false
+	}
+	return rawIndex(p, i)
+}
+
+// Get returns the named param with the given name. Names are matched exactly.
+// If the name is present multiple times, the last value is returned, like encoding/json decodes it.
+// It returns false if the params are not named, or if the name is not present.
+func (p Params) Get(name string) (json.RawMessage, bool) {
+	if !p.valid() {
+		return nil, false
+	}
+	return rawField(p, name)
+}
+
+// valid checks if the params are a single complete JSON value, optionally surrounded by whitespace.
+func (p Params) valid() bool {
+	end, err := scanValue(p, scanSpace(p, 0))
+	return err == nil && scanSpace(p, end) == len(p)
+}
+
+// rawIndex returns the element at index i of the JSON array data.
+func rawIndex(data []byte, i int) (out json.RawMessage, ok bool) {
+	start := scanSpace(data, 0)
+	if i < 0 || start >= len(data) || data[start] != '[' {
+		return nil, false
+	}
+	n := 0
+	_, _ = scanArray(data, start, 1, func(start, end int) bool {
+		if n == i {
+			out, ok = json.RawMessage(data[start:end]), true
+			return false
+		}
+		n++
+		return true
+	})
+	return out, ok
+}
+
+// rawField returns the value of the last member with the given name in the JSON object data.
+func rawField(data []byte, name string) (out json.RawMessage, ok bool) {
+	start := scanSpace(data, 0)
+	if start >= len(data) || data[start] != '{' {
+		return nil, false
+	}
+	_, err := scanObject(data, start, 1, func(keyStart, keyEnd, start, end int) bool {
+		if stringEquals(data[keyStart:keyEnd], name) {
+			out, ok = json.RawMessage(data[start:end]), true
+		}
+		return true
+	})
+	if err != nil {
+		return nil, false
+	}
+	return out, ok
+}
+
+// Items iterates over the positional params. It yields nothing if the params are not positional,
+// or if the params are invalid.
+func (p Params) Items() iter.Seq[json.RawMessage] {
+	return func(yield func(json.RawMessage) bool) {
+		start := scanSpace(p, 0)
+		if start >= len(p) || p[start] != '[' || !p.valid() {
+			return
+		}
+		_, _ = scanArray(p, start, 1, func(start, end int) bool {
+			return yield(json.RawMessage(p[start:end]))
+		})
+	}
+}
+
+// Pairs iterates over the names and values of named params. It yields nothing if the params are not named,
+// or if the params are invalid.
+func (p Params) Pairs() iter.Seq2[string, json.RawMessage] {
+	return func(yield func(string, json.RawMessage) bool) {
+		start := scanSpace(p, 0)
+		if start >= len(p) || p[start] != '{' || !p.valid() {
+			return
+		}
+		_, _ = scanObject(p, start, 1, func(keyStart, keyEnd, start, end int) bool {
+			return yield(unquoteString(p[keyStart:keyEnd]), json.RawMessage(p[start:end]))
+		})
+	}
+}
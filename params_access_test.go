@@ -0,0 +1,140 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParamsAccess(t *testing.T) {
+	list := Params(` ["0x1", {"toBlock": "latest"}, false] `)
+	named := Params(`{"from": "0xaa", "to": "0xbb", "esc\u0061ped": 1, "to": "0xcc"}`)
+	t.Run("kind", func(t *testing.T) {
+		if !list.IsPositional() || list.IsNamed() {
+			t.Fatal("expected positional params")
+		}
+		if !named.IsNamed() || named.IsPositional() {
+			t.Fatal("expected named params")
+		}
+		if Params("").IsNamed() || Params("").IsPositional() {
+			t.Fatal("empty params are neither")
+		}
+	})
+	t.Run("len", func(t *testing.T) {
+		if n := list.Len(); n != 3 {
+			t.Fatalf("expected 3 params, got %d", n)
+		}
+		if n := named.Len(); n != 4 {
+			t.Fatalf("expected 4 params, got %d", n)
+		}
+		if n := Params(`[1, 2`).Len(); n != 0 {
+			t.Fatalf("expected 0 for invalid params, got %d", n)
+		}
+		if n := Params(`[1] x`).Len(); n != 0 {
+			t.Fatalf("expected 0 for trailing data, got %d", n)
+		}
+		if n := Params(`[]`).Count(); n != 0 {
+			t.Fatalf("expected 0 for empty list, got %d", n)
+		}
+	})
+	t.Run("at", func(t *testing.T) {
+		v, ok := list.At(1)
+		if !ok || string(v) != `{"toBlock": "latest"}` {
+			t.Fatalf("unexpected param: %s", v)
+		}
+		if _, ok := list.At(3); ok {
+			t.Fatal("expected no param at index 3")
+		}
+		if _, ok := list.At(-1); ok {
+			t.Fatal("expected no param at negative index")
+		}
+		if _, ok := named.At(0); ok {
+			t.Fatal("expected no positional param in named params")
+		}
+	})
+	t.Run("get", func(t *testing.T) {
+		v, ok := named.Get("from")
+		if !ok || string(v) != `"0xaa"` {
+			t.Fatalf("unexpected param: %s", v)
+		}
+		v, ok = named.Get("to")
+		if !ok || string(v) != `"0xcc"` {
+			t.Fatalf("expected last duplicate, got: %s", v)
+		}
+		v, ok = named.Get("escaped")
+		if !ok || string(v) != `1` {
+			t.Fatalf("expected escaped key match, got: %s", v)
+		}
+		if _, ok := named.Get("FROM"); ok {
+			t.Fatal("expected exact name match")
+		}
+		if _, ok := list.Get("from"); ok {
+			t.Fatal("expected no named param in positional params")
+		}
+	})
+	t.Run("items", func(t *testing.T) {
+		var items []string
+		for v := range list.Items() {
+			items = append(items, string(v))
+		}
+		if len(items) != 3 || items[0] != `"0x1"` || items[2] != `false` {
+			t.Fatalf("unexpected items: %v", items)
+		}
+		for range named.Items() {
+			t.Fatal("expected no items in named params")
+		}
+	})
+	t.Run("pairs", func(t *testing.T) {
+		var keys []string
+		for k, v := range named.Pairs() {
+			keys = append(keys, k)
+			if !json.Valid(v) {
+				t.Fatalf("invalid value: %s", v)
+			}
+			if k == "to" {
+				break
+			}
+		}
+		if len(keys) != 2 || keys[0] != "from" || keys[1] != "to" {
+			t.Fatalf("unexpected keys: %v", keys)
+		}
+	})
+	t.Run("truncated array", func(t *testing.T) {
+		p := Params(`[1, 2`)
+		if _, ok := p.At(0); ok {
+			t.Fatal("expected no param in truncated array")
+		}
+		for range p.Items() {
+			t.Fatal("expected no items in truncated array")
+		}
+	})
+	t.Run("truncated object", func(t *testing.T) {
+		p := Params(`{"a": 1, "b": 2`)
+		if _, ok := p.Get("a"); ok {
+			t.Fatal("expected no param in truncated object")
+		}
+		for range p.Pairs() {
+			t.Fatal("expected no pairs in truncated object")
+		}
+	})
+	t.Run("trailing data", func(t *testing.T) {
+		p := Params(`[1] x`)
+		if _, ok := p.At(0); ok {
+			t.Fatal("expected no param with trailing data")
+		}
+		for range p.Items() {
+			t.Fatal("expected no items with trailing data")
+		}
+	})
+	t.Run("no allocations", func(t *testing.T) {
+		allocs := testing.AllocsPerRun(100, func() {
+			list.Len()
+			list.At(2)
+			named.Get("to")
+			for range list.Items() {
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("expected no allocations, got %f", allocs)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maximum length of the offending JSON value included in a ParamError
+const maxSnippetLength = 64
+
+// ParamError describes why a single param failed to decode.
+type ParamError struct {
+	// Index is the position of the param, or -1 if the params are named or the position is unknown.
+	Index int
+	// Name is the name of the param, if the params are named.
+	Name string
+	// Path is the JSON path of the offending value, from the root of the params, e.g. "$[1].toBlock".
+	Path string
+	// Type is the Go type that the offending value was decoded into, if known.
+	Type string
+	// Snippet is the offending JSON value, truncated if it is long.
+	Snippet string
+	// Err is the underlying decoding error.
+	Err error
+}
+
+func (e *ParamError) Error() string {
+	var b strings.Builder
+	if e.Name != "" {
+		fmt.Fprintf(&b, "param %q", e.Name)
+	} else if e.Index >= 0 {
+		fmt.Fprintf(&b, "param %d", e.Index)
+	} else {
+		b.WriteString("params")
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&b, " at %s", e.Path)
+	}
+	if e.Type != "" {
+		fmt.Fprintf(&b, " (%s)", e.Type)
+	}
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// ParamsError is returned by ParamsDecoder when params are invalid.
+// It either describes a problem with the params as a whole, such as the wrong number of params,
+// or lists each param that failed to decode.
+type ParamsError struct {
+	// Code is the error code to respond with. If zero, InvalidParams is used.
+	Code ErrorConst
+	// Reason describes a problem with the params as a whole, if any.
+	Reason string
+	// Params lists the params that failed to decode.
+	Params []*ParamError
+}
+
+func (e *ParamsError) Error() string {
+	if e.Reason != "" {
+		return "invalid params: " + e.Reason
+	}
+	msgs := make([]string, len(e.Params))
+	for i, p := range e.Params {
+		msgs[i] = p.Error()
+	}
+	return "invalid params: " + strings.Join(msgs, "; ")
+}
+
+func (e *ParamsError) Unwrap() []error {
+	errs := make([]error, len(e.Params))
+	for i, p := range e.Params {
+		errs[i] = p
+	}
+	return errs
+}
+
+type jsonParamError struct {
+	Index   *int   `json:"index,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// ErrorObject converts the error into an error object, with InvalidParams as default error code.
+// The Data lists the failing params, with their index or name, JSON path, expected type, offending value and message.
+func (e *ParamsError) ErrorObject() *ErrorObject {
+	code := e.Code
+	if code == 0 {
+		code = InvalidParams
+	}
+	obj := ConstErrorObj(code)
+	if e.Reason != "" {
+		obj.Message += ": " + e.Reason
+	}
+	if len(e.Params) == 0 {
+		return obj
+	}
+	items := make([]jsonParamError, len(e.Params))
+	for i, p := range e.Params {
+		items[i] = jsonParamError{
+			Name:  p.Name,
+			Path:  p.Path,
+			Type:  p.Type,
+			Value: p.Snippet,
+		}
+		if p.Index >= 0 {
+			items[i].Index = &p.Index
+		}
+		if p.Err != nil {
+			items[i].Message = p.Err.Error()
+		}
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return obj
+	}
+	obj.Data = data
+	return obj
+}
+
+// newParamError describes the error of decoding the JSON value into the Go type.
+// The path is the JSON path of the value, and is extended to the offending value within it, if known.
+func newParamError(index int, name string, path string, value []byte, typ reflect.Type, err error) *ParamError {
+	out := &ParamError{
+		Index: index,
+		Name:  name,
+		Path:  path,
+		Err:   err,
+	}
+	if typ != nil {
+		out.Type = typ.String()
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Type != nil {
+			out.Type = typeErr.Type.String()
+		}
+		if typeErr.Field != "" {
+			value, out.Path = jsonPathValue(value, path, typeErr.Field)
+		}
+	}
+	out.Snippet = snippet(value)
+	return out
+}
+
+// jsonPathValue follows the dot-separated encoding/json field path into the JSON value,
+// and returns the value at the end of the path, and the path in JSON path notation.
+// If the path cannot be followed, the value and path up to that point are returned.
+func jsonPathValue(value []byte, path string, field string) ([]byte, string) {
+	for _, seg := range strings.Split(field, ".") {
+		value = trimSpace(value)
+		if len(value) == 0 {
+			break
+		}
+		switch value[0] {
+		case '[':
+			i, err := strconv.Atoi(seg)
+			if err != nil {
+				return value, path
+			}
+			var items []json.RawMessage
+			if err := json.Unmarshal(value, &items); err != nil || i < 0 || i >= len(items) {
+				return value, path
+			}
+			value = items[i]
+			path += "[" + seg + "]"
+		case '{':
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal(value, &obj); err != nil {
+				return value, path
+			}
+			v, ok := obj[seg]
+			if !ok {
+				for k, x := range obj {
+					if strings.EqualFold(k, seg) {
+						v, ok = x, true
+						break
+					}
+				}
+			}
+			if !ok {
+				return value, path
+			}
+			value = v
+			path += "." + seg
+		default:
+			return value, path
+		}
+	}
+	return value, path
+}
+
+func snippet(value []byte) string {
+	value = trimSpace(value)
+	if len(value) <= maxSnippetLength {
+		return strings.ToValidUTF8(string(value), "")
+	}
+	end := maxSnippetLength
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	return strings.ToValidUTF8(string(value[:end]), "") + "..."
+}
+
+// asParamsError wraps the error of decoding the params into the Go type as ParamsError, if it is not one already.
+func asParamsError(err error, p Params, typ reflect.Type) *ParamsError {
+	if pErr, ok := err.(*ParamsError); ok {
+		return pErr
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &ParamsError{Params: []*ParamError{newParamError(-1, "", "$", p, typ, err)}}
+	}
+	return &ParamsError{Reason: err.Error()}
+}
@@ -0,0 +1,105 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParamsError(t *testing.T) {
+	type inner struct {
+		ToBlock uint64 `json:"toBlock"`
+	}
+	type obj struct {
+		Addr   string  `json:"address"`
+		Filter []inner `json:"filter"`
+	}
+	t.Run("positional field errors", func(t *testing.T) {
+		_, err := ParamsDecoder[obj]()(Params(`[123, [{"toBlock": 1}, {"toBlock": "latest"}]]`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 2 {
+			t.Fatalf("expected 2 failing params, got %d", len(pErr.Params))
+		}
+		first := pErr.Params[0]
+		if first.Index != 0 || first.Path != "$[0]" || first.Type != "string" || first.Snippet != "123" {
+			t.Fatalf("unexpected first param error: %+v", first)
+		}
+		second := pErr.Params[1]
+		if second.Index != 1 || second.Path != "$[1][1].toBlock" || second.Type != "uint64" || second.Snippet != `"latest"` {
+			t.Fatalf("unexpected second param error: %+v", second)
+		}
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatal("expected underlying type error to be unwrappable")
+		}
+	})
+	t.Run("named field errors", func(t *testing.T) {
+		_, err := ParamsDecoder[obj](DisallowUnknownFields())(Params(`{"address": true, "extra": 1}`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 2 {
+			t.Fatalf("expected 2 failing params, got %d", len(pErr.Params))
+		}
+		if p := pErr.Params[0]; p.Index != -1 || p.Name != "address" || p.Path != "$.address" || p.Snippet != "true" {
+			t.Fatalf("unexpected param error: %+v", p)
+		}
+		if p := pErr.Params[1]; p.Name != "extra" {
+			t.Fatalf("unexpected param error: %+v", p)
+		}
+	})
+	t.Run("params count", func(t *testing.T) {
+		_, err := ParamsDecoder[obj]()(Params(`["0xaa"]`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if pErr.Reason == "" || len(pErr.Params) != 0 {
+			t.Fatalf("expected params-level reason, got %+v", pErr)
+		}
+		obj := pErr.ErrorObject()
+		if obj.Code != InvalidParams.Code() || obj.Data != nil {
+			t.Fatalf("unexpected error object: %+v", obj)
+		}
+	})
+	t.Run("list elements", func(t *testing.T) {
+		_, err := ParamsDecoder[[]int]()(Params(`[1, "two"]`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 1 || pErr.Params[0].Path != "$[1]" || pErr.Params[0].Snippet != `"two"` {
+			t.Fatalf("unexpected params error: %+v", pErr.Params[0])
+		}
+	})
+	t.Run("long snippet", func(t *testing.T) {
+		long := `"` + string(make([]byte, 100)) + `"`
+		p := newParamError(0, "", "$[0]", []byte(long), nil, errors.New("test"))
+		if len(p.Snippet) != maxSnippetLength+len("...") {
+			t.Fatalf("expected truncated snippet, got %d bytes", len(p.Snippet))
+		}
+	})
+	t.Run("error object", func(t *testing.T) {
+		_, err := ParamsDecoder[obj]()(Params(`[123, []]`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		obj := pErr.ErrorObject()
+		if obj.Code != InvalidParams.Code() {
+			t.Fatalf("unexpected code %d", obj.Code)
+		}
+		var data []map[string]any
+		if err := json.Unmarshal(obj.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 1 || data[0]["index"] != float64(0) || data[0]["path"] != "$[0]" ||
+			data[0]["type"] != "string" || data[0]["value"] != "123" || data[0]["message"] == "" {
+			t.Fatalf("unexpected error data: %s", obj.Data)
+		}
+	})
+}
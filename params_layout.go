@@ -0,0 +1,491 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The "param" struct tag controls how a struct field maps to RPC params:
+//
+//	Foo string `param:"-"`                   // skipped, never decoded or encoded
+//	Foo string `param:"2"`                   // explicit position in positional params
+//	Foo string `param:",optional"`           // may be omitted from the end of positional params
+//	Foo string `param:",default=\"latest\""` // optional, with a JSON default value if omitted
+//
+// The default option must be the last option, since the JSON value may contain commas.
+// Named params use the json struct tag for the field name, and its "string" and "omitempty" options, as encoding/json does.
+// Fields of embedded structs are flattened into the params, also in positional params, as encoding/json does for objects.
+const paramTag = "param"
+
+type paramField struct {
+	// index sequence of the field, through embedded structs, as used by reflect.Value.FieldByIndex
+	index []int
+	typ   reflect.Type
+	// key in named params, empty if the field cannot be named
+	name string
+	// position in positional params
+	pos      int
+	optional bool
+	// JSON default value, nil if none
+	def json.RawMessage
+	// json tag options, for named params
+	quoted    bool
+	omitEmpty bool
+}
+
+type paramsLayout struct {
+	// fields, in declaration order
+	fields []paramField
+	// indices into fields, in positional order
+	positional []int
+	// the minimum number of positional params
+	required int
+}
+
+var paramsLayouts sync.Map // reflect.Type -> *paramsLayout or error
+
+// structLayout determines the params layout of a struct type, and caches it.
+func structLayout(typ reflect.Type) (*paramsLayout, error) {
+	if v, ok := paramsLayouts.Load(typ); ok {
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		return v.(*paramsLayout), nil
+	}
+	layout, err := newStructLayout(typ)
+	if err != nil {
+		err = fmt.Errorf("invalid params type %s: %w", typ, err)
+		paramsLayouts.Store(typ, err)
+		return nil, err
+	}
+	paramsLayouts.Store(typ, layout)
+	return layout, nil
+}
+
+// structField is a candidate params field, before name conflicts between embedded structs are resolved.
+type structField struct {
+	reflect.StructField
+	name string
+	// the name is set by a json tag
+	tagged bool
+	// json tag options
+	quoted    bool
+	omitEmpty bool
+}
+
+// collectFields lists the fields of the struct type, in declaration order.
+// Like encoding/json, the fields of embedded structs without a json name are flattened into the parent.
+// An embedded struct with a param tag is a regular field.
+func collectFields(typ reflect.Type, index []int, visiting map[reflect.Type]bool, out *[]structField) {
+	visiting[typ] = true
+	defer delete(visiting, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		f.Index = append(index[:len(index):len(index)], i)
+		tag, hasTag := f.Tag.Lookup(paramTag)
+		if tag == "-" {
+			continue
+		}
+		jsonTag, jsonOpts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous {
+			t := f.Type
+			if t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+			if !f.IsExported() && (t.Kind() != reflect.Struct || f.Type.Kind() == reflect.Pointer) {
+				// like encoding/json, ignore embedded unexported non-struct types, and pointers to unexported structs,
+				// which cannot be allocated
+				continue
+			}
+			if t.Kind() == reflect.Struct && jsonTag == "" && !hasTag {
+				if !visiting[t] {
+					collectFields(t, f.Index, visiting, out)
+				}
+				continue
+			}
+		} else if !f.IsExported() {
+			continue
+		}
+		sf := structField{StructField: f, name: f.Name}
+		if f.Tag.Get("json") == "-" {
+			sf.name = ""
+		} else if jsonTag != "" {
+			sf.name = jsonTag
+			sf.tagged = true
+		}
+		for _, opt := range strings.Split(jsonOpts, ",") {
+			switch opt {
+			case "omitempty":
+				sf.omitEmpty = true
+			case "string":
+				sf.quoted = quotable(f.Type)
+			}
+		}
+		*out = append(*out, sf)
+	}
+}
+
+// dominantFields drops the fields that are hidden by other fields with the same name, following the encoding/json rules:
+// the least nested field wins, then a field named by a json tag, and if that is still ambiguous, all of them are dropped.
+func dominantFields(fields []structField) []structField {
+	byName := make(map[string][]int)
+	for i, f := range fields {
+		if f.name != "" {
+			byName[f.name] = append(byName[f.name], i)
+		}
+	}
+	drop := make([]bool, len(fields))
+	for _, group := range byName {
+		if len(group) == 1 {
+			continue
+		}
+		var winners []int
+		for _, i := range group {
+			switch {
+			case len(winners) == 0 || len(fields[i].Index) < len(fields[winners[0]].Index):
+				winners = []int{i}
+			case len(fields[i].Index) == len(fields[winners[0]].Index):
+				winners = append(winners, i)
+			}
+		}
+		if len(winners) > 1 {
+			var tagged []int
+			for _, i := range winners {
+				if fields[i].tagged {
+					tagged = append(tagged, i)
+				}
+			}
+			winners = tagged
+		}
+		for _, i := range group {
+			drop[i] = len(winners) != 1 || winners[0] != i
+		}
+	}
+	out := fields[:0:0]
+	for i, f := range fields {
+		if !drop[i] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func newStructLayout(typ reflect.Type) (*paramsLayout, error) {
+	var fields []structField
+	collectFields(typ, nil, make(map[reflect.Type]bool), &fields)
+	layout := &paramsLayout{}
+	for _, f := range dominantFields(fields) {
+		pf := paramField{
+			index:     f.Index,
+			typ:       f.Type,
+			name:      f.name,
+			pos:       len(layout.fields),
+			quoted:    f.quoted,
+			omitEmpty: f.omitEmpty,
+		}
+		posStr, opts, _ := strings.Cut(f.Tag.Get(paramTag), ",")
+		if posStr != "" {
+			pos, err := strconv.ParseUint(posStr, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: invalid param position %q", f.Name, posStr)
+			}
+			pf.pos = int(pos)
+		}
+		for opts != "" {
+			var opt string
+			if strings.HasPrefix(opts, "default=") {
+				opt, opts = opts, ""
+			} else {
+				opt, opts, _ = strings.Cut(opts, ",")
+			}
+			switch {
+			case opt == "optional":
+				pf.optional = true
+			case strings.HasPrefix(opt, "default="):
+				def := json.RawMessage(strings.TrimPrefix(opt, "default="))
+				if err := json.Unmarshal(def, reflect.New(f.Type).Interface()); err != nil {
+					return nil, fmt.Errorf("field %s: invalid default value: %w", f.Name, err)
+				}
+				pf.optional = true
+				pf.def = def
+			default:
+				return nil, fmt.Errorf("field %s: unknown param tag option %q", f.Name, opt)
+			}
+		}
+		layout.fields = append(layout.fields, pf)
+	}
+	layout.positional = make([]int, len(layout.fields))
+	for i := range layout.positional {
+		layout.positional[i] = i
+	}
+	sort.SliceStable(layout.positional, func(i, j int) bool {
+		return layout.fields[layout.positional[i]].pos < layout.fields[layout.positional[j]].pos
+	})
+	for i, fi := range layout.positional {
+		f := &layout.fields[fi]
+		if f.pos != i {
+			if i > 0 && layout.fields[layout.positional[i-1]].pos == f.pos {
+				return nil, fmt.Errorf("duplicate param position %d", f.pos)
+			}
+			return nil, fmt.Errorf("missing param position %d", i)
+		}
+		if f.optional {
+			continue
+		}
+		if layout.required != i {
+			return nil, fmt.Errorf("required param %d follows an optional param", i)
+		}
+		layout.required = i + 1
+	}
+	return layout, nil
+}
+
+// decodePositional decodes the list of params into the fields of the struct v.
+func (layout *paramsLayout) decodePositional(cfg *decoderConfig, items []json.RawMessage, v reflect.Value) error {
+	if len(items) < layout.required || len(items) > len(layout.fields) {
+		if layout.required == len(layout.fields) {
+			return fmt.Errorf("expected %d params, got %d params", len(layout.fields), len(items))
+		}
+		return fmt.Errorf("expected %d to %d params, got %d params", layout.required, len(layout.fields), len(items))
+	}
+	var errs []*ParamError
+	for pos, fi := range layout.positional {
+		f := &layout.fields[fi]
+		if pos >= len(items) {
+			if err := f.applyDefault(v); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := f.decode(cfg, items[pos], v); err != nil {
+			path := "$[" + strconv.Itoa(pos) + "]"
+			errs = append(errs, newParamError(pos, "", path, items[pos], f.typ, err))
+		}
+	}
+	if len(errs) > 0 {
+		return &ParamsError{Params: errs}
+	}
+	return nil
+}
+
+// decodeNamed decodes the map of params into the fields of the struct v.
+// Like encoding/json, exact key matches are preferred, but keys are otherwise matched case-insensitively,
+// and unknown keys are ignored, and omitted fields are left as they are, unless configured otherwise.
+func (layout *paramsLayout) decodeNamed(cfg *decoderConfig, data []byte, v reflect.Value) error {
+	for i := range layout.fields {
+		if err := layout.fields[i].applyDefault(v); err != nil {
+			return err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil { // opening brace
+		return err
+	}
+	var errs []*ParamError
+	seen := make(map[*paramField]bool)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		path := "$." + key
+		f := layout.lookup(key, cfg.caseSensitive)
+		if f == nil {
+			if cfg.disallowUnknownFields {
+				errs = append(errs, newParamError(-1, key, path, value, nil, errors.New("unknown param")))
+			}
+			continue
+		}
+		seen[f] = true
+		if f.quoted {
+			unquoted, err := unquote(value)
+			if err != nil {
+				errs = append(errs, newParamError(-1, key, path, value, f.typ, err))
+				continue
+			}
+			value = unquoted
+		}
+		if err := f.decode(cfg, value, v); err != nil {
+			errs = append(errs, newParamError(-1, key, path, value, f.typ, err))
+		}
+	}
+	for i := range layout.fields {
+		// fields without a name cannot be set by named params, and are left to validation
+		if f := &layout.fields[i]; cfg.requireNamed && !seen[f] && !f.optional && f.name != "" {
+			errs = append(errs, newParamError(-1, f.name, "$."+f.name, nil, f.typ, errors.New("missing param")))
+		}
+	}
+	if len(errs) > 0 {
+		return &ParamsError{Params: errs}
+	}
+	return nil
+}
+
+func (layout *paramsLayout) lookup(key string, caseSensitive bool) *paramField {
+	var folded *paramField
+	for i := range layout.fields {
+		f := &layout.fields[i]
+		if f.name == "" {
+			continue
+		}
+		if f.name == key {
+			return f
+		}
+		if folded == nil && !caseSensitive && strings.EqualFold(f.name, key) {
+			folded = f
+		}
+	}
+	return folded
+}
+
+// field returns the field of the struct v, allocating nil embedded struct pointers on the way.
+func (f *paramField) field(v reflect.Value) reflect.Value {
+	for i, x := range f.index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// value returns the field of the struct v, or false if it is in a nil embedded struct pointer.
+func (f *paramField) value(v reflect.Value) (reflect.Value, bool) {
+	fv, err := v.FieldByIndexErr(f.index)
+	return fv, err == nil
+}
+
+// decode decodes the JSON value into the field of the struct v.
+func (f *paramField) decode(cfg *decoderConfig, data json.RawMessage, v reflect.Value) error {
+	fv := f.field(v)
+	if cfg.disallowNull && bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		if k := fv.Kind(); k != reflect.Pointer && k != reflect.Interface {
+			return errors.New("null is not allowed")
+		}
+	}
+	return cfg.unmarshal(data, fv.Addr().Interface())
+}
+
+func (f *paramField) applyDefault(v reflect.Value) error {
+	if f.def == nil {
+		return nil
+	}
+	return json.Unmarshal(f.def, f.field(v).Addr().Interface())
+}
+
+// encodePositional encodes the fields of the struct v as list of params.
+// Trailing optional fields without a default are omitted if they are zero,
+// since omitting a field with a default would decode as the default instead.
+func (layout *paramsLayout) encodePositional(v reflect.Value) ([]byte, error) {
+	n := len(layout.positional)
+	for n > 0 {
+		f := &layout.fields[layout.positional[n-1]]
+		if fv, ok := f.value(v); !f.optional || f.def != nil || (ok && !fv.IsZero()) {
+			break
+		}
+		n--
+	}
+	items := make([]json.RawMessage, n)
+	for pos, fi := range layout.positional[:n] {
+		f := &layout.fields[fi]
+		fv, ok := f.value(v)
+		if !ok {
+			fv = reflect.Zero(f.typ)
+		}
+		item, err := json.Marshal(fv.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode field %d: %w", pos, err)
+		}
+		items[pos] = item
+	}
+	return json.Marshal(items)
+}
+
+// encodeNamed encodes the fields of the struct v as map of params.
+// Optional fields without a default are omitted if they are zero, and like encoding/json,
+// fields of nil embedded struct pointers are omitted.
+func (layout *paramsLayout) encodeNamed(v reflect.Value) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := range layout.fields {
+		f := &layout.fields[i]
+		fv, ok := f.value(v)
+		if !ok || f.name == "" || (f.optional && f.def == nil && fv.IsZero()) || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		item, err := json.Marshal(fv.Interface())
+		if err == nil && f.quoted && string(item) != "null" {
+			item, err = json.Marshal(string(item))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode field %q: %w", f.name, err)
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(item)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// quotable checks if the json "string" option applies to the type, as encoding/json only applies it
+// to strings, numbers and booleans, and pointers to them.
+func quotable(typ reflect.Type) bool {
+	if typ.Name() == "" && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// unquote returns the JSON value within the JSON string of a field with the json "string" option.
+func unquote(data json.RawMessage) (json.RawMessage, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return data, nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, errors.New("expected JSON string, as the field has the json string option")
+	}
+	return json.RawMessage(s), nil
+}
+
+// isEmptyValue checks if the value is empty, as the json "omitempty" option defines it.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
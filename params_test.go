@@ -2,6 +2,9 @@ package jsonrpc
 
 import (
 	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -244,3 +247,569 @@ func TestParamsDecoder(t *testing.T) {
 		}
 	})
 }
+
+func TestParamsEncoder(t *testing.T) {
+	t.Run("struct as list", func(t *testing.T) {
+		enc := ParamsEncoder[TestObj]()
+		got, err := enc(TestObj{Foo: "hello", Bar: 1234})
+		if err != nil {
+			t.Fatal("must encode struct. Err:", err)
+		}
+		if string(got) != `["hello",1234]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("struct as object", func(t *testing.T) {
+		enc := ParamsEncoder[TestObj](NamedParams())
+		got, err := enc(TestObj{Foo: "hello", Bar: 1234})
+		if err != nil {
+			t.Fatal("must encode struct. Err:", err)
+		}
+		if string(got) != `{"foo":"hello","bar":1234}` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("pointer struct round-trip", func(t *testing.T) {
+		enc := ParamsEncoder[*TestObj]()
+		got, err := enc(&TestObj{Foo: "hello", Bar: 1234})
+		if err != nil {
+			t.Fatal("must encode struct. Err:", err)
+		}
+		dec := ParamsDecoder[*TestObj]()
+		out, err := dec(got)
+		if err != nil {
+			t.Fatal("must decode encoded params. Err:", err)
+		}
+		if out.Foo != "hello" || out.Bar != 1234 {
+			t.Fatal("unexpected round-trip result")
+		}
+	})
+	t.Run("nil pointer", func(t *testing.T) {
+		enc := ParamsEncoder[*TestObj]()
+		got, err := enc(nil)
+		if err != nil {
+			t.Fatal("must encode nil as empty params. Err:", err)
+		}
+		if len(got) != 0 {
+			t.Fatal("expected empty params")
+		}
+	})
+	t.Run("empty struct", func(t *testing.T) {
+		enc := ParamsEncoder[struct{}]()
+		got, err := enc(struct{}{})
+		if err != nil {
+			t.Fatal("must encode empty struct as empty params. Err:", err)
+		}
+		if len(got) != 0 {
+			t.Fatal("expected empty params")
+		}
+	})
+	t.Run("nil slice", func(t *testing.T) {
+		enc := ParamsEncoder[[]any]()
+		got, err := enc(nil)
+		if err != nil {
+			t.Fatal("must encode nil slice. Err:", err)
+		}
+		if string(got) != `[]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("slice stays list", func(t *testing.T) {
+		enc := ParamsEncoder[[]any](NamedParams())
+		got, err := enc([]any{"0x1", false})
+		if err != nil {
+			t.Fatal("must encode slice. Err:", err)
+		}
+		if string(got) != `["0x1",false]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("map", func(t *testing.T) {
+		enc := ParamsEncoder[map[string]int]()
+		got, err := enc(map[string]int{"a": 1})
+		if err != nil {
+			t.Fatal("must encode map. Err:", err)
+		}
+		if string(got) != `{"a":1}` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("string", func(t *testing.T) {
+		enc := ParamsEncoder[string]()
+		_, err := enc("hello")
+		if err == nil {
+			t.Fatal("cannot encode string as params")
+		}
+	})
+	t.Run("bytes", func(t *testing.T) {
+		enc := ParamsEncoder[[]byte]()
+		_, err := enc([]byte("hello"))
+		if err == nil {
+			t.Fatal("cannot encode base64 string as params")
+		}
+	})
+	t.Run("unexported field", func(t *testing.T) {
+		type obj struct {
+			Foo string
+			bar int
+		}
+		got, err := ParamsEncoder[obj]()(obj{Foo: "hello", bar: 1234})
+		if err != nil {
+			t.Fatal("must skip unexported field. Err:", err)
+		}
+		if string(got) != `["hello"]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("raw params", func(t *testing.T) {
+		enc := ParamsEncoder[Params]()
+		got, err := enc(Params(`{"a": 1}`))
+		if err != nil {
+			t.Fatal("must accept raw params. Err:", err)
+		}
+		if string(got) != `{"a": 1}` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+}
+
+type TaggedObj struct {
+	Addr    string `json:"address"`
+	Block   string `json:"block" param:",default=\"latest\""`
+	Skipped int    `param:"-"`
+	Full    bool   `json:"full" param:",optional"`
+	private int
+}
+
+type ReorderedObj struct {
+	A string `param:"1"`
+	B int    `param:"0"`
+}
+
+func TestParamsDecoderTags(t *testing.T) {
+	t.Run("all params", func(t *testing.T) {
+		got, err := ParamsDecoder[TaggedObj]()(Params(`["0xaa", "0x1", true]`))
+		if err != nil {
+			t.Fatal("must accept all params. Err:", err)
+		}
+		if got.Addr != "0xaa" || got.Block != "0x1" || !got.Full {
+			t.Fatal("unexpected values")
+		}
+	})
+	t.Run("omitted trailing params", func(t *testing.T) {
+		got, err := ParamsDecoder[TaggedObj]()(Params(`["0xaa"]`))
+		if err != nil {
+			t.Fatal("must accept omitted optional params. Err:", err)
+		}
+		if got.Addr != "0xaa" || got.Block != "latest" || got.Full {
+			t.Fatal("unexpected values")
+		}
+	})
+	t.Run("missing required param", func(t *testing.T) {
+		_, err := ParamsDecoder[TaggedObj]()(Params(`[]`))
+		if err == nil {
+			t.Fatal("cannot accept missing required param")
+		}
+	})
+	t.Run("too many params", func(t *testing.T) {
+		_, err := ParamsDecoder[TaggedObj]()(Params(`["0xaa", "0x1", true, 4]`))
+		if err == nil {
+			t.Fatal("cannot accept skipped or unexported fields as params")
+		}
+	})
+	t.Run("named with default", func(t *testing.T) {
+		got, err := ParamsDecoder[*TaggedObj]()(Params(`{"address": "0xaa", "Skipped": 3}`))
+		if err != nil {
+			t.Fatal("must accept named params. Err:", err)
+		}
+		if got.Addr != "0xaa" || got.Block != "latest" || got.Skipped != 0 {
+			t.Fatal("unexpected values")
+		}
+	})
+	t.Run("named case-insensitive", func(t *testing.T) {
+		got, err := ParamsDecoder[TaggedObj]()(Params(`{"ADDRESS": "0xaa", "block": "0x2"}`))
+		if err != nil {
+			t.Fatal("must accept named params. Err:", err)
+		}
+		if got.Addr != "0xaa" || got.Block != "0x2" {
+			t.Fatal("unexpected values")
+		}
+	})
+	t.Run("explicit positions", func(t *testing.T) {
+		got, err := ParamsDecoder[ReorderedObj]()(Params(`[1234, "hello"]`))
+		if err != nil {
+			t.Fatal("must accept reordered params. Err:", err)
+		}
+		if got.A != "hello" || got.B != 1234 {
+			t.Fatal("unexpected values")
+		}
+	})
+	t.Run("all optional with empty params", func(t *testing.T) {
+		type obj struct {
+			Block string `param:",default=\"latest\""`
+		}
+		got, err := ParamsDecoder[obj]()(Params(""))
+		if err != nil {
+			t.Fatal("must accept empty params if all are optional. Err:", err)
+		}
+		if got.Block != "latest" {
+			t.Fatal("expected default value")
+		}
+	})
+	t.Run("invalid tags", func(t *testing.T) {
+		type gap struct {
+			A string `param:"1"`
+		}
+		if _, err := ParamsDecoder[gap]()(Params(`["a"]`)); err == nil {
+			t.Fatal("expected error for missing position")
+		}
+		type order struct {
+			A string `param:",optional"`
+			B string
+		}
+		if _, err := ParamsDecoder[order]()(Params(`["a", "b"]`)); err == nil {
+			t.Fatal("expected error for required param after optional param")
+		}
+		type badDefault struct {
+			A int `param:",default=\"x\""`
+		}
+		if _, err := ParamsDecoder[badDefault]()(Params(`[1]`)); err == nil {
+			t.Fatal("expected error for invalid default")
+		}
+	})
+	t.Run("encode omits trailing zero optional params", func(t *testing.T) {
+		got, err := ParamsEncoder[TaggedObj]()(TaggedObj{Addr: "0xaa", Block: "0x1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `["0xaa","0x1"]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+		got, err = ParamsEncoder[ReorderedObj]()(ReorderedObj{A: "hello", B: 1234})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `[1234,"hello"]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("encode named", func(t *testing.T) {
+		got, err := ParamsEncoder[TaggedObj](NamedParams())(TaggedObj{Addr: "0xaa", Skipped: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `{"address":"0xaa","block":""}` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("encode keeps zero params with default", func(t *testing.T) {
+		got, err := ParamsEncoder[TaggedObj]()(TaggedObj{Addr: "0xaa"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `["0xaa",""]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+		dec, err := ParamsDecoder[TaggedObj]()(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dec.Block != "" {
+			t.Fatalf("expected zero value to round-trip, got %q", dec.Block)
+		}
+	})
+}
+
+type EmbeddedObj struct {
+	TestObj
+	Baz bool `json:"baz"`
+}
+
+type EmbeddedPtrObj struct {
+	*TestObj
+	Bar string `json:"bar"`
+}
+
+// CustomObj decodes and encodes named params as a single "value" string.
+type CustomObj struct {
+	A, B string
+}
+
+func (o *CustomObj) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	o.A, o.B, _ = strings.Cut(v.Value, ":")
+	return nil
+}
+
+func (o CustomObj) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"value": o.A + ":" + o.B})
+}
+
+func TestParamsEmbedded(t *testing.T) {
+	t.Run("named", func(t *testing.T) {
+		got, err := ParamsDecoder[EmbeddedObj](DisallowUnknownFields())(Params(`{"foo": "a", "bar": 1, "baz": true}`))
+		if err != nil {
+			t.Fatal("must accept fields of embedded struct. Err:", err)
+		}
+		if got.Foo != "a" || got.Bar != 1 || !got.Baz {
+			t.Fatalf("unexpected values: %+v", got)
+		}
+	})
+	t.Run("positional", func(t *testing.T) {
+		got, err := ParamsDecoder[EmbeddedObj]()(Params(`["a", 1, true]`))
+		if err != nil {
+			t.Fatal("must accept fields of embedded struct. Err:", err)
+		}
+		if got.Foo != "a" || got.Bar != 1 || !got.Baz {
+			t.Fatalf("unexpected values: %+v", got)
+		}
+	})
+	t.Run("embedded pointer is allocated", func(t *testing.T) {
+		got, err := ParamsDecoder[EmbeddedPtrObj]()(Params(`{"foo": "a", "bar": "b"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.TestObj == nil || got.TestObj.Foo != "a" {
+			t.Fatalf("expected embedded struct to be allocated: %+v", got)
+		}
+		// the outer bar field hides the embedded one
+		if got.Bar != "b" || got.TestObj.Bar != 0 {
+			t.Fatalf("unexpected values: %+v", got)
+		}
+	})
+	t.Run("encode", func(t *testing.T) {
+		v := EmbeddedObj{TestObj: TestObj{Foo: "a", Bar: 1}, Baz: true}
+		got, err := ParamsEncoder[EmbeddedObj](NamedParams())(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `{"foo":"a","bar":1,"baz":true}` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+		got, err = ParamsEncoder[EmbeddedObj]()(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `["a",1,true]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("encode nil embedded pointer", func(t *testing.T) {
+		got, err := ParamsEncoder[EmbeddedPtrObj](NamedParams())(EmbeddedPtrObj{Bar: "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `{"bar":"b"}` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+		got, err = ParamsEncoder[EmbeddedPtrObj]()(EmbeddedPtrObj{Bar: "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `["","b"]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("custom unmarshaler", func(t *testing.T) {
+		got, err := ParamsDecoder[*CustomObj]()(Params(`{"value": "x:y"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.A != "x" || got.B != "y" {
+			t.Fatalf("expected UnmarshalJSON to be used: %+v", got)
+		}
+	})
+	t.Run("custom marshaler", func(t *testing.T) {
+		got, err := ParamsEncoder[CustomObj](NamedParams())(CustomObj{A: "x", B: "y"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != `{"value":"x:y"}` {
+			t.Fatalf("expected MarshalJSON to be used: %s", got)
+		}
+	})
+}
+
+func TestParamsJSONTagOptions(t *testing.T) {
+	type obj struct {
+		A string `json:"a"`
+		B int    `json:"b,omitempty"`
+		C int    `json:"c,string"`
+		D *int   `json:"d,omitempty,string"`
+	}
+	t.Run("encode", func(t *testing.T) {
+		v := obj{A: "x", C: 5}
+		got, err := ParamsEncoder[obj](NamedParams())(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := json.Marshal(v)
+		if string(got) != `{"a":"x","c":"5"}` || string(got) != string(want) {
+			t.Fatalf("unexpected params: %s, encoding/json gives %s", got, want)
+		}
+		d := 7
+		if got, _ = ParamsEncoder[obj](NamedParams())(obj{B: 1, D: &d}); string(got) != `{"a":"","b":1,"c":"0","d":"7"}` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("decode string option", func(t *testing.T) {
+		got, err := ParamsDecoder[obj]()(Params(`{"a": "x", "c": "5", "d": "7"}`))
+		if err != nil {
+			t.Fatal("must accept quoted values. Err:", err)
+		}
+		if got.C != 5 || got.D == nil || *got.D != 7 {
+			t.Fatalf("unexpected values: %+v", got)
+		}
+		if _, err := ParamsDecoder[obj]()(Params(`{"c": 5}`)); err == nil {
+			t.Fatal("must reject unquoted value, like encoding/json does")
+		}
+	})
+}
+
+func TestParamsDecoderOptions(t *testing.T) {
+	t.Run("unknown fields allowed by default", func(t *testing.T) {
+		_, err := ParamsDecoder[TestObj]()(Params(`{"foo": "hello", "baz": 1}`))
+		if err != nil {
+			t.Fatal("must ignore unknown fields by default. Err:", err)
+		}
+	})
+	t.Run("disallow unknown fields", func(t *testing.T) {
+		dec := ParamsDecoder[TestObj](DisallowUnknownFields())
+		if _, err := dec(Params(`{"foo": "hello", "baz": 1}`)); err == nil {
+			t.Fatal("must reject unknown fields")
+		}
+		if _, err := dec(Params(`{"foo": "hello", "bar": 1}`)); err != nil {
+			t.Fatal("must accept known fields. Err:", err)
+		}
+	})
+	t.Run("disallow unknown nested fields", func(t *testing.T) {
+		type obj struct {
+			Inner TestObj `json:"inner"`
+		}
+		dec := ParamsDecoder[obj](DisallowUnknownFields())
+		if _, err := dec(Params(`[{"foo": "hello", "baz": 1}]`)); err == nil {
+			t.Fatal("must reject unknown nested fields")
+		}
+	})
+	t.Run("case sensitive", func(t *testing.T) {
+		dec := ParamsDecoder[TestObj](CaseSensitive())
+		got, err := dec(Params(`{"FOO": "hello", "bar": 1}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Foo != "" || got.Bar != 1 {
+			t.Fatal("must only match exact names")
+		}
+		dec = ParamsDecoder[TestObj](CaseSensitive(), DisallowUnknownFields())
+		if _, err := dec(Params(`{"FOO": "hello"}`)); err == nil {
+			t.Fatal("must reject differently cased name as unknown")
+		}
+	})
+	t.Run("case sensitive only applies to params", func(t *testing.T) {
+		type obj struct {
+			Inner TestObj `json:"inner"`
+		}
+		got, err := ParamsDecoder[obj](CaseSensitive())(Params(`{"inner": {"FOO": "hello", "bar": 1}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Inner.Foo != "hello" {
+			t.Fatal("expected nested keys to be matched case-insensitively")
+		}
+	})
+	t.Run("missing named params allowed by default", func(t *testing.T) {
+		got, err := ParamsDecoder[TaggedObj]()(Params(`{"block": "0x1"}`))
+		if err != nil {
+			t.Fatal("must accept omitted named params by default. Err:", err)
+		}
+		if got.Addr != "" || got.Block != "0x1" {
+			t.Fatal("unexpected values")
+		}
+	})
+	t.Run("require named params", func(t *testing.T) {
+		dec := ParamsDecoder[TaggedObj](RequireNamedParams())
+		_, err := dec(Params(`{"block": "0x1"}`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 1 || pErr.Params[0].Name != "address" || pErr.Params[0].Path != "$.address" {
+			t.Fatalf("expected missing address param: %v", err)
+		}
+		// optional params may still be omitted
+		if _, err := dec(Params(`{"address": "0xaa"}`)); err != nil {
+			t.Fatal("must accept omitted optional params. Err:", err)
+		}
+	})
+	t.Run("null allowed by default", func(t *testing.T) {
+		if _, err := ParamsDecoder[TestObj]()(Params(`[null, 1]`)); err != nil {
+			t.Fatal("must accept null by default. Err:", err)
+		}
+	})
+	t.Run("disallow null", func(t *testing.T) {
+		dec := ParamsDecoder[TestObj](DisallowNull())
+		if _, err := dec(Params(`[null, 1]`)); err == nil {
+			t.Fatal("must reject positional null")
+		}
+		if _, err := dec(Params(`{"foo": null}`)); err == nil {
+			t.Fatal("must reject named null")
+		}
+		type obj struct {
+			Foo *string
+		}
+		if _, err := ParamsDecoder[obj](DisallowNull())(Params(`[null]`)); err != nil {
+			t.Fatal("must accept null for pointer field. Err:", err)
+		}
+	})
+	t.Run("disallow null only applies to params", func(t *testing.T) {
+		type obj struct {
+			Inner TestObj `json:"inner"`
+		}
+		got, err := ParamsDecoder[obj](DisallowNull())(Params(`[{"foo": null, "bar": 1}]`))
+		if err != nil {
+			t.Fatal("must accept nested null. Err:", err)
+		}
+		if got.Inner.Bar != 1 {
+			t.Fatal("unexpected values")
+		}
+	})
+	type anyObj struct {
+		X any
+	}
+	t.Run("json numbers by default", func(t *testing.T) {
+		got, err := ParamsDecoder[anyObj]()(Params(`[12345678901234567890]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.X.(json.Number) != "12345678901234567890" {
+			t.Fatal("expected json number")
+		}
+	})
+	t.Run("float64 numbers", func(t *testing.T) {
+		got, err := ParamsDecoder[[]any](Numbers(Float64Numbers))(Params(`[1.5]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[0].(float64) != 1.5 {
+			t.Fatal("expected float64")
+		}
+	})
+	t.Run("big int numbers", func(t *testing.T) {
+		got, err := ParamsDecoder[anyObj](Numbers(BigIntNumbers))(Params(`[{"a": [12345678901234567890]}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := got.X.(map[string]any)["a"].([]any)[0].(*big.Int)
+		if x.String() != "12345678901234567890" {
+			t.Fatal("unexpected big int")
+		}
+		if _, err := ParamsDecoder[[]any](Numbers(BigIntNumbers))(Params(`[1.5]`)); err == nil {
+			t.Fatal("must reject non-integer number")
+		}
+	})
+}
@@ -0,0 +1,424 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Conn is a bidirectional stream of payloads between two peers, such as a websocket.
+// Each payload is a single message or a batch.
+//
+// Read is not called concurrently with itself, but may be called concurrently with Write,
+// and Write is not called concurrently with itself.
+// Implementations return when the context is done, and may close the connection to do so.
+type Conn interface {
+	// Read reads the next payload. The returned data is owned by the caller.
+	Read(ctx context.Context) ([]byte, error)
+	// Write writes a payload.
+	Write(ctx context.Context, data []byte) error
+	// Close closes the connection, and makes pending and future reads and writes fail.
+	Close() error
+}
+
+// MessageConn is a Conn that can also pass messages as structs, without encoding them, such as an in-memory pipe.
+// Peers use it instead of reading and writing payloads.
+type MessageConn interface {
+	Conn
+	// ReadMessage reads the next message. The returned message is owned by the caller.
+	// A payload that is not a single valid message, such as a batch, is returned as *PayloadError.
+	ReadMessage(ctx context.Context) (*Message, error)
+	// WriteMessage writes the message. The message must not be modified afterward.
+	WriteMessage(ctx context.Context, msg *Message) error
+}
+
+// PayloadError is returned by MessageConn.ReadMessage for a payload that cannot be read as single message,
+// such as a batch. Peers serve the payload as-is instead, to respond like to any other payload.
+type PayloadError struct {
+	Payload []byte
+	Err     error
+}
+
+func (e *PayloadError) Error() string {
+	return "cannot read payload as message: " + e.Err.Error()
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// ErrPeerClosed is returned for calls to a peer that is closed.
+var ErrPeerClosed = errors.New("peer connection closed")
+
+// Notifier sends notifications to the peer that sent the request.
+// Handlers of bidirectional connections find it in the request context, with NotifierFromContext,
+// e.g. to implement subscriptions.
+type Notifier interface {
+	Notify(ctx context.Context, method string, params any) error
+	// Closed is closed when the connection to the peer is closed.
+	Closed() <-chan struct{}
+}
+
+type notifierKey struct{}
+
+// NotifierFromContext returns the Notifier of the peer that sent the request, if the connection is bidirectional.
+func NotifierFromContext(ctx context.Context) (Notifier, bool) {
+	n, ok := ctx.Value(notifierKey{}).(Notifier)
+	return n, ok
+}
+
+// ContextWithNotifier returns a context that provides the Notifier to handlers, for custom transports.
+func ContextWithNotifier(ctx context.Context, n Notifier) context.Context {
+	return context.WithValue(ctx, notifierKey{}, n)
+}
+
+// PeerOption configures NewPeer.
+type PeerOption func(cfg *peerConfig)
+
+type peerConfig struct {
+	serveOptions []ServeOption
+}
+
+// PeerServeOptions configures how the peer serves incoming requests, see Serve.
+func PeerServeOptions(opts ...ServeOption) PeerOption {
+	return func(cfg *peerConfig) {
+		cfg.serveOptions = append(cfg.serveOptions, opts...)
+	}
+}
+
+// Peer is one end of a bidirectional connection: it serves requests of the other end with its handler,
+// and calls and notifies the other end.
+type Peer struct {
+	conn    Conn
+	handler Handler
+	cfg     peerConfig
+
+	writeMu sync.Mutex
+	lastID  atomic.Uint64
+
+	mu sync.Mutex
+	// pending calls by request ID, nil when closed
+	pending map[RawID]chan *Message
+	// closed when the peer is closed
+	closed  chan struct{}
+	err     error
+	closing atomic.Bool
+
+	handlers sync.WaitGroup
+	// done when the last notification is served, only used by the read loop
+	lastNotification chan struct{}
+}
+
+var _ Notifier = (*Peer)(nil)
+
+// NewPeer creates a peer on the connection. The handler may be nil, to respond with MethodNotFound to all requests.
+// Run must be called to read from the connection.
+func NewPeer(conn Conn, h Handler, opts ...PeerOption) *Peer {
+	if h == nil {
+		h = HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			return req.RespondErr(ConstErrorObj(MethodNotFound))
+		})
+	}
+	p := &Peer{
+		conn:    conn,
+		handler: h,
+		pending: make(map[RawID]chan *Message),
+		closed:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&p.cfg)
+	}
+	return p
+}
+
+// Run reads from the connection until it fails or the context is done, and closes the peer.
+// Requests are served concurrently, and notifications in order, with the Notifier of the peer in their context,
+// and Run waits for their handlers to return after the connection is closed.
+// It returns nil if the peer was closed with Close.
+//
+// If the connection is a MessageConn, messages are passed to the handler as read, and ServeOptions do not apply,
+// except to payloads that cannot be read as message, which are served like payloads of other connections.
+func (p *Peer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var err error
+	if mc, ok := p.conn.(MessageConn); ok {
+		for {
+			var msg *Message
+			if msg, err = mc.ReadMessage(ctx); err != nil {
+				var payloadErr *PayloadError
+				if errors.As(err, &payloadErr) {
+					p.dispatch(ctx, payloadErr.Payload)
+					continue
+				}
+				break
+			}
+			p.dispatchMessage(ctx, msg)
+		}
+	} else {
+		for {
+			var data []byte
+			if data, err = p.conn.Read(ctx); err != nil {
+				break
+			}
+			p.dispatch(ctx, data)
+		}
+	}
+	p.shutdown(err)
+	cancel()
+	p.handlers.Wait()
+	if p.closing.Load() {
+		return nil
+	}
+	return err
+}
+
+// dispatch delivers responses to pending calls, and serves requests.
+// Single notifications are served one at a time, in order of arrival, e.g. to process subscription events in order.
+// Other payloads are served concurrently.
+func (p *Peer) dispatch(ctx context.Context, data []byte) {
+	i := scanSpace(data, 0)
+	ordered := false
+	if i < len(data) && data[i] == '[' {
+		var elems [][]byte
+		_, err := scanArray(data, i, 1, func(start, end int) bool {
+			elems = append(elems, data[start:end])
+			return true
+		})
+		// invalid and empty batches are served as-is, to respond with an error
+		if err == nil && len(elems) > 0 {
+			var requests [][]byte
+			for _, elem := range elems {
+				if !p.deliver(elem) {
+					requests = append(requests, elem)
+				}
+			}
+			if len(requests) == 0 {
+				return
+			}
+			if len(requests) < len(elems) {
+				data = append(append([]byte{'['}, joinPayloads(requests)...), ']')
+			}
+		}
+	} else if p.deliver(data) {
+		return
+	} else {
+		var s ScannedMessage
+		ordered = ScanMessage(data, &s) == nil && s.ID == nil
+	}
+	p.handle(ordered, func() {
+		out := Serve(ContextWithNotifier(ctx, p), data, p.handler, p.cfg.serveOptions...)
+		if out != nil {
+			_ = p.write(ctx, out)
+		}
+	})
+}
+
+// dispatchMessage delivers a response to the pending call, or serves a request, like dispatch does.
+func (p *Peer) dispatchMessage(ctx context.Context, msg *Message) {
+	if msg.Kind() == KindInvalid {
+		if !msg.ID.IsNotification() {
+			resp := errorResponse(msg.ID, invalidRequest(errors.New("message must be either a request or response")))
+			p.handle(false, func() { _ = p.writeMessage(ctx, resp) })
+		}
+		return
+	}
+	if msg.Response != nil {
+		p.deliverMessage(msg)
+		return
+	}
+	notification := msg.ID.IsNotification()
+	p.handle(notification, func() {
+		resp := callHandler(ContextWithNotifier(ctx, p), p.handler, msg)
+		if !notification {
+			_ = p.writeMessage(ctx, resp)
+		}
+	})
+}
+
+// handle runs the function in a handler goroutine. Ordered functions run one at a time, in order of dispatch.
+func (p *Peer) handle(ordered bool, fn func()) {
+	var prev, done chan struct{}
+	if ordered {
+		prev, done = p.lastNotification, make(chan struct{})
+		p.lastNotification = done
+	}
+	p.handlers.Add(1)
+	go func() {
+		defer p.handlers.Done()
+		if ordered {
+			defer close(done)
+			if prev != nil {
+				<-prev
+			}
+		}
+		fn()
+	}()
+}
+
+func joinPayloads(items [][]byte) []byte {
+	var out []byte
+	for i, item := range items {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, item...)
+	}
+	return out
+}
+
+// deliver delivers the message to the pending call, if it is a response. Responses to unknown calls are dropped.
+func (p *Peer) deliver(data []byte) bool {
+	var s ScannedMessage
+	if err := ScanMessage(data, &s); err != nil || !s.IsResponse {
+		return false
+	}
+	resp, err := s.Message()
+	if err == nil {
+		p.deliverMessage(resp)
+	}
+	return true
+}
+
+func (p *Peer) deliverMessage(resp *Message) {
+	p.mu.Lock()
+	ch, ok := p.pending[resp.ID]
+	delete(p.pending, resp.ID)
+	p.mu.Unlock()
+	if ok {
+		ch <- resp
+	}
+}
+
+// shutdown closes the peer, with the error as reason.
+func (p *Peer) shutdown(err error) {
+	p.mu.Lock()
+	if p.pending == nil {
+		p.mu.Unlock()
+		return
+	}
+	p.pending = nil
+	p.err = err
+	close(p.closed)
+	p.mu.Unlock()
+	// the connection may still read responses while closing
+	_ = p.conn.Close()
+}
+
+// Close closes the connection. Pending calls fail with ErrPeerClosed.
+func (p *Peer) Close() error {
+	p.closing.Store(true)
+	p.shutdown(ErrPeerClosed)
+	return nil
+}
+
+// Closed is closed when the peer is closed.
+func (p *Peer) Closed() <-chan struct{} {
+	return p.closed
+}
+
+func (p *Peer) closedErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil || errors.Is(p.err, ErrPeerClosed) {
+		return ErrPeerClosed
+	}
+	return fmt.Errorf("%w: %w", ErrPeerClosed, p.err)
+}
+
+// Call sends a request to the other peer, waits for the response,
+// and decodes the result into the result value, unless it is nil.
+// An error response is returned as *ErrorObject.
+func (p *Peer) Call(ctx context.Context, method string, params any, result any) error {
+	id := RawID(strconv.FormatUint(p.lastID.Add(1), 10))
+	req, err := NewRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+	ch := make(chan *Message, 1)
+	p.mu.Lock()
+	if p.pending == nil {
+		p.mu.Unlock()
+		return p.closedErr()
+	}
+	p.pending[id] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+	if err := p.Send(ctx, req); err != nil {
+		return err
+	}
+	select {
+	case resp := <-ch:
+		return decodeResult(resp, result)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.closed:
+		return p.closedErr()
+	}
+}
+
+// Notify sends a notification to the other peer.
+func (p *Peer) Notify(ctx context.Context, method string, params any) error {
+	msg, err := NewNotification(method, params)
+	if err != nil {
+		return err
+	}
+	return p.Send(ctx, msg)
+}
+
+// Send sends the message to the other peer, without waiting for a response.
+// The message must not be modified afterward, since a MessageConn may pass it as-is.
+func (p *Peer) Send(ctx context.Context, msg *Message) error {
+	if _, ok := p.conn.(MessageConn); ok {
+		return p.writeMessage(ctx, msg)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return p.write(ctx, data)
+}
+
+func (p *Peer) write(ctx context.Context, data []byte) error {
+	select {
+	case <-p.closed:
+		return p.closedErr()
+	default:
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return p.conn.Write(ctx, data)
+}
+
+func (p *Peer) writeMessage(ctx context.Context, msg *Message) error {
+	select {
+	case <-p.closed:
+		return p.closedErr()
+	default:
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return p.conn.(MessageConn).WriteMessage(ctx, msg)
+}
+
+// decodeResult returns the error of the response, or decodes the result into the result value, unless it is nil.
+func decodeResult(resp *Message, result any) error {
+	if resp == nil || resp.Response == nil {
+		return errors.New("missing response")
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.RawResult(), result)
+}
@@ -0,0 +1,123 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPeer(t *testing.T) {
+	// the pipe ends are wrapped to hide their MessageConn methods, to test the payload path of peers, including batches
+	a, b := NewPipe()
+	notified := make(chan string, 1)
+	client := NewPeer(struct{ Conn }{a}, HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		if req.Method == "notify_hello" {
+			notified <- string(req.Params)
+		}
+		return req.Respond(nil)
+	}))
+	server := NewPeer(struct{ Conn }{b}, HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		if req.Method == "hello" {
+			n, ok := NotifierFromContext(ctx)
+			if !ok {
+				return req.RespondErr(ConstErrorObj(InternalError))
+			}
+			if err := n.Notify(ctx, "notify_hello", []string{"world"}); err != nil {
+				return req.RespondErr(AsErrorObj(err))
+			}
+			return req.Respond("hi")
+		}
+		return specHandler(ctx, req)
+	}))
+	ctx := context.Background()
+	clientDone, serverDone := make(chan error, 1), make(chan error, 1)
+	go func() { clientDone <- client.Run(ctx) }()
+	go func() { serverDone <- server.Run(ctx) }()
+
+	t.Run("call", func(t *testing.T) {
+		var result int
+		if err := client.Call(ctx, "subtract", []int{42, 23}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 19 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var obj *ErrorObject
+		if err := client.Call(ctx, "foo.get", nil, nil); !errors.As(err, &obj) || obj.Code != MethodNotFound.Code() {
+			t.Fatalf("expected method not found, got %v", err)
+		}
+	})
+	t.Run("notifier", func(t *testing.T) {
+		var result string
+		if err := client.Call(ctx, "hello", nil, &result); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case params := <-notified:
+			if params != `["world"]` {
+				t.Fatalf("unexpected notification params: %s", params)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no notification")
+		}
+	})
+	t.Run("reverse call", func(t *testing.T) {
+		// the server peer calls the client peer, which responds to any method
+		if err := server.Call(ctx, "anything", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("response batch", func(t *testing.T) {
+		// responses in a batch are delivered, requests in the same batch are served
+		// the server receives the response to the request, as if it sent the request
+		ch, served := make(chan *Message, 1), make(chan *Message, 1)
+		client.mu.Lock()
+		client.pending[`"x1"`] = ch
+		client.mu.Unlock()
+		server.mu.Lock()
+		server.pending[`"r1"`] = served
+		server.mu.Unlock()
+		err := b.Write(ctx, []byte(`[{"jsonrpc":"2.0","id":"x1","result":5},{"jsonrpc":"2.0","id":"r1","method":"anything"}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case resp := <-ch:
+			if string(resp.RawResult()) != "5" {
+				t.Fatalf("unexpected response: %v", resp)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("response not delivered")
+		}
+		select {
+		case resp := <-served:
+			if resp.Kind() != KindSuccessResponse || string(resp.RawResult()) != "null" {
+				t.Fatalf("unexpected response: %v", resp)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("request not served")
+		}
+	})
+	t.Run("close", func(t *testing.T) {
+		if err := client.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-clientDone; err != nil {
+			t.Fatalf("expected no error after Close, got %v", err)
+		}
+		if err := <-serverDone; err == nil {
+			t.Fatal("expected read error for server")
+		}
+		if err := client.Call(ctx, "sum", []int{1}, nil); !errors.Is(err, ErrPeerClosed) {
+			t.Fatalf("expected closed error, got %v", err)
+		}
+		select {
+		case <-server.Closed():
+		default:
+			t.Fatal("server peer not closed")
+		}
+	})
+}
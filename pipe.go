@@ -0,0 +1,309 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// PipeOption configures NewPipe.
+type PipeOption func(cfg *pipeConfig)
+
+type pipeConfig struct {
+	json     bool
+	latency  time.Duration
+	jitter   time.Duration
+	reorder  bool
+	dropRate float64
+	seed     uint64
+	seeded   bool
+}
+
+// PipeJSON encodes and decodes every message that passes the pipe, like a network transport does,
+// e.g. to test that params and results survive the round trip. By default, messages are passed as structs.
+func PipeJSON() PipeOption {
+	return func(cfg *pipeConfig) {
+		cfg.json = true
+	}
+}
+
+// PipeLatency delays every message by the latency, plus a random duration up to the jitter.
+// Messages arrive in the order they were sent, unless PipeReorder is used.
+func PipeLatency(latency, jitter time.Duration) PipeOption {
+	return func(cfg *pipeConfig) {
+		cfg.latency = latency
+		cfg.jitter = jitter
+	}
+}
+
+// PipeReorder lets messages with less delay overtake messages that were sent earlier, see PipeLatency.
+func PipeReorder() PipeOption {
+	return func(cfg *pipeConfig) {
+		cfg.reorder = true
+	}
+}
+
+// PipeDropRate drops messages at random, with the given probability between 0 and 1.
+func PipeDropRate(p float64) PipeOption {
+	return func(cfg *pipeConfig) {
+		cfg.dropRate = p
+	}
+}
+
+// PipeSeed seeds the randomness of jitter and drops, to make simulations reproducible.
+func PipeSeed(seed uint64) PipeOption {
+	return func(cfg *pipeConfig) {
+		cfg.seed = seed
+		cfg.seeded = true
+	}
+}
+
+// PipeConn is one end of an in-memory pipe, see NewPipe.
+type PipeConn struct {
+	cfg    *pipeConfig
+	in     *pipeQueue
+	out    *pipeQueue
+	closed chan struct{}
+	// closed when the other end is closed
+	remoteClosed <-chan struct{}
+	closeOnce    sync.Once
+}
+
+var _ MessageConn = (*PipeConn)(nil)
+
+// NewPipe creates the two ends of an in-memory connection, e.g. to embed a service in the same process,
+// or to test peers under simulated network conditions. Each end is used with NewPeer.
+// Writes do not block: messages are buffered until they are read.
+func NewPipe(opts ...PipeOption) (*PipeConn, *PipeConn) {
+	cfg := &pipeConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	var rng *rand.Rand
+	if cfg.seeded {
+		rng = rand.New(rand.NewPCG(cfg.seed, cfg.seed))
+	} else {
+		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	var rngMu sync.Mutex
+	random := func() float64 {
+		rngMu.Lock()
+		defer rngMu.Unlock()
+		return rng.Float64()
+	}
+	ab, ba := newPipeQueue(cfg, random), newPipeQueue(cfg, random)
+	a := &PipeConn{cfg: cfg, in: ba, out: ab, closed: make(chan struct{})}
+	b := &PipeConn{cfg: cfg, in: ab, out: ba, closed: make(chan struct{})}
+	a.remoteClosed, b.remoteClosed = b.closed, a.closed
+	return a, b
+}
+
+// Read reads the next payload, and encodes it if it was written as message.
+func (c *PipeConn) Read(ctx context.Context) ([]byte, error) {
+	item, err := c.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if item.msg != nil {
+		return json.Marshal(item.msg)
+	}
+	return item.data, nil
+}
+
+// ReadMessage reads the next message, and decodes it if it was written as payload or if PipeJSON is used.
+// Batches and invalid payloads cannot be read as message, and are returned as *PayloadError.
+func (c *PipeConn) ReadMessage(ctx context.Context) (*Message, error) {
+	item, err := c.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if item.msg != nil {
+		return item.msg, nil
+	}
+	msg, err := DecodeMessage(item.data)
+	if err != nil {
+		return nil, &PayloadError{Payload: item.data, Err: err}
+	}
+	return msg, nil
+}
+
+func (c *PipeConn) read(ctx context.Context) (pipeItem, error) {
+	for {
+		select {
+		case <-c.closed:
+			return pipeItem{}, io.ErrClosedPipe
+		default:
+		}
+		item, ok, wait := c.in.pop()
+		if ok {
+			return item, nil
+		}
+		if err := c.wait(ctx, wait); err != nil {
+			return pipeItem{}, err
+		}
+	}
+}
+
+// wait waits for a write, or for the next item to be due if wait is not 0.
+// Items that the remote end wrote before it closed are still delivered, like a network connection does.
+func (c *PipeConn) wait(ctx context.Context, wait time.Duration) error {
+	var due <-chan time.Time
+	remoteClosed := c.remoteClosed
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		due = t.C
+		remoteClosed = nil
+	}
+	select {
+	case <-c.in.wake:
+		return nil
+	case <-due:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return io.ErrClosedPipe
+	case <-remoteClosed:
+		if c.in.len() > 0 { // written just before the close
+			return nil
+		}
+		return io.EOF
+	}
+}
+
+// Write writes a copy of the payload.
+func (c *PipeConn) Write(ctx context.Context, data []byte) error {
+	return c.write(ctx, pipeItem{data: bytes.Clone(data)})
+}
+
+// WriteMessage writes the message, which is passed as-is unless PipeJSON is used.
+func (c *PipeConn) WriteMessage(ctx context.Context, msg *Message) error {
+	if c.cfg.json {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return c.write(ctx, pipeItem{data: data})
+	}
+	return c.write(ctx, pipeItem{msg: msg})
+}
+
+func (c *PipeConn) write(ctx context.Context, item pipeItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-c.closed:
+		return io.ErrClosedPipe
+	case <-c.remoteClosed:
+		return io.ErrClosedPipe
+	default:
+	}
+	c.out.push(item)
+	return nil
+}
+
+// Close closes this end. Reads from the other end fail with io.EOF.
+func (c *PipeConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+type pipeItem struct {
+	data []byte
+	msg  *Message
+	// deliverAt is when the item can be read, and seq the order of writing, to break ties
+	deliverAt time.Time
+	seq       uint64
+}
+
+// pipeQueue holds the items of one direction of a pipe, until they are delivered.
+type pipeQueue struct {
+	cfg    *pipeConfig
+	random func() float64
+
+	mu    sync.Mutex
+	items pipeHeap
+	seq   uint64
+	last  time.Time
+	// signals the reader that an item was pushed
+	wake chan struct{}
+}
+
+func newPipeQueue(cfg *pipeConfig, random func() float64) *pipeQueue {
+	return &pipeQueue{cfg: cfg, random: random, wake: make(chan struct{}, 1)}
+}
+
+func (q *pipeQueue) push(item pipeItem) {
+	if q.cfg.dropRate > 0 && q.random() < q.cfg.dropRate {
+		return
+	}
+	q.mu.Lock()
+	delay := q.cfg.latency
+	if q.cfg.jitter > 0 {
+		delay += time.Duration(q.random() * float64(q.cfg.jitter))
+	}
+	item.deliverAt = time.Now().Add(delay)
+	if !q.cfg.reorder && item.deliverAt.Before(q.last) {
+		item.deliverAt = q.last
+	}
+	q.last = item.deliverAt
+	q.seq++
+	item.seq = q.seq
+	heap.Push(&q.items, item)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *pipeQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// pop returns the next item that is due, or how long to wait for the next item, 0 if there is none.
+func (q *pipeQueue) pop() (item pipeItem, ok bool, wait time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return pipeItem{}, false, 0
+	}
+	if wait = time.Until(q.items[0].deliverAt); wait > 0 {
+		return pipeItem{}, false, wait
+	}
+	return heap.Pop(&q.items).(pipeItem), true, 0
+}
+
+// pipeHeap orders items by delivery time, and then by order of writing.
+type pipeHeap []pipeItem
+
+func (h pipeHeap) Len() int { return len(h) }
+
+func (h pipeHeap) Less(i, j int) bool {
+	if h[i].deliverAt.Equal(h[j].deliverAt) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].deliverAt.Before(h[j].deliverAt)
+}
+
+func (h pipeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *pipeHeap) Push(x any) { *h = append(*h, x.(pipeItem)) }
+
+func (h *pipeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,236 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func newPipePeers(t *testing.T, h Handler, opts ...PipeOption) *Peer {
+	t.Helper()
+	a, b := NewPipe(opts...)
+	server := NewPeer(a, h)
+	client := NewPeer(b, nil)
+	go func() { _ = server.Run(context.Background()) }()
+	go func() { _ = client.Run(context.Background()) }()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client
+}
+
+func TestPipe(t *testing.T) {
+	params := make(chan string, 1)
+	echo := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		params <- string(req.Params)
+		return req.Respond(true)
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		client := newPipePeers(t, echo)
+		if err := client.Call(context.Background(), "echo", Params(`[1, 2]`), nil); err != nil {
+			t.Fatal(err)
+		}
+		// the params are passed as-is, without being compacted by encoding
+		if got := <-params; got != `[1, 2]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("json", func(t *testing.T) {
+		client := newPipePeers(t, echo, PipeJSON())
+		if err := client.Call(context.Background(), "echo", Params(`[1, 2]`), nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-params; got != `[1,2]` {
+			t.Fatalf("unexpected params: %s", got)
+		}
+	})
+	t.Run("spec", func(t *testing.T) {
+		for _, opts := range [][]PipeOption{nil, {PipeJSON()}} {
+			client := newPipePeers(t, specHandler, opts...)
+			var result int
+			if err := client.Call(context.Background(), "subtract", []int{42, 23}, &result); err != nil {
+				t.Fatal(err)
+			}
+			if result != 19 {
+				t.Fatalf("unexpected result: %d", result)
+			}
+			var obj *ErrorObject
+			if err := client.Call(context.Background(), "foo.get", nil, nil); !errors.As(err, &obj) || obj.Code != MethodNotFound.Code() {
+				t.Fatalf("expected method not found, got %v", err)
+			}
+		}
+	})
+	t.Run("payloads", func(t *testing.T) {
+		a, b := NewPipe()
+		defer a.Close()
+		msg, err := NewNotification("hello", []int{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.WriteMessage(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		data, err := b.Read(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"method":"hello","params":[1],"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected payload: %s", data)
+		}
+		if err := b.Write(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+		got, err := a.ReadMessage(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Method != "hello" || string(got.Params) != `[1]` {
+			t.Fatalf("unexpected message: %v", got)
+		}
+	})
+	t.Run("batch payload", func(t *testing.T) {
+		// payloads that are not a single message are served as payload, and do not stop the peer
+		a, b := NewPipe()
+		server := NewPeer(a, specHandler)
+		go func() { _ = server.Run(context.Background()) }()
+		defer server.Close()
+		ctx := context.Background()
+		if err := b.Write(ctx, []byte(`[{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}]`)); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := b.Read(ctx); err != nil || string(data) != `[{"result":1,"id":1,"jsonrpc":"2.0"}]` {
+			t.Fatalf("unexpected batch response: %s %v", data, err)
+		}
+		if err := b.Write(ctx, []byte(`1`)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := b.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg, err := DecodeMessage(data); err != nil || !msg.Response.IsError() {
+			t.Fatalf("expected error response, got %s", data)
+		}
+		msg, _ := NewRequest("2", "subtract", []int{3, 1})
+		if err := b.WriteMessage(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		if resp, err := b.ReadMessage(ctx); err != nil || string(resp.RawResult()) != "2" {
+			t.Fatalf("unexpected response: %v %v", resp, err)
+		}
+	})
+	t.Run("latency", func(t *testing.T) {
+		client := newPipePeers(t, specHandler, PipeLatency(50*time.Millisecond, 0))
+		start := time.Now()
+		if err := client.Call(context.Background(), "subtract", []int{2, 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < 100*time.Millisecond {
+			t.Fatalf("round trip too fast: %s", d)
+		}
+	})
+	sendAll := func(t *testing.T, opts ...PipeOption) []int {
+		t.Helper()
+		a, b := NewPipe(opts...)
+		defer a.Close()
+		for i := 0; i < 50; i++ {
+			msg, err := NewNotification("seq", []int{i})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := a.WriteMessage(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var out []int
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			msg, err := b.ReadMessage(ctx)
+			cancel()
+			if errors.Is(err, context.DeadlineExceeded) {
+				return out
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var i []int
+			if err := json.Unmarshal(msg.Params, &i); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, i[0])
+		}
+	}
+	inOrder := func(seq []int) bool {
+		for i := 1; i < len(seq); i++ {
+			if seq[i] < seq[i-1] {
+				return false
+			}
+		}
+		return true
+	}
+	t.Run("jitter in order", func(t *testing.T) {
+		seq := sendAll(t, PipeLatency(0, 20*time.Millisecond), PipeSeed(1))
+		if len(seq) != 50 || !inOrder(seq) {
+			t.Fatalf("expected all messages in order, got %v", seq)
+		}
+	})
+	t.Run("reorder", func(t *testing.T) {
+		seq := sendAll(t, PipeLatency(0, 20*time.Millisecond), PipeReorder(), PipeSeed(1))
+		if len(seq) != 50 || inOrder(seq) {
+			t.Fatalf("expected all messages out of order, got %v", seq)
+		}
+	})
+	t.Run("drop", func(t *testing.T) {
+		seq := sendAll(t, PipeDropRate(0.5), PipeSeed(1))
+		if len(seq) < 10 || len(seq) > 40 || !inOrder(seq) {
+			t.Fatalf("expected about half of the messages, got %v", seq)
+		}
+	})
+	t.Run("dropped call", func(t *testing.T) {
+		client := newPipePeers(t, specHandler, PipeDropRate(1))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := client.Call(ctx, "subtract", []int{2, 1}, nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	})
+	t.Run("close", func(t *testing.T) {
+		a, b := NewPipe()
+		server := NewPeer(a, specHandler)
+		done := make(chan error, 1)
+		go func() { done <- server.Run(context.Background()) }()
+		_ = b.Close()
+		if err := <-done; !errors.Is(err, io.EOF) {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+		if _, err := b.ReadMessage(context.Background()); !errors.Is(err, io.ErrClosedPipe) {
+			t.Fatalf("expected closed pipe, got %v", err)
+		}
+		if err := a.Write(context.Background(), []byte(`{}`)); !errors.Is(err, io.ErrClosedPipe) {
+			t.Fatalf("expected closed pipe, got %v", err)
+		}
+	})
+	t.Run("close with messages in flight", func(t *testing.T) {
+		a, b := NewPipe(PipeLatency(20*time.Millisecond, 0))
+		ctx := context.Background()
+		for _, data := range []string{`1`, `2`} {
+			if err := b.Write(ctx, []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_ = b.Close()
+		for _, want := range []string{`1`, `2`} {
+			if data, err := a.Read(ctx); err != nil || string(data) != want {
+				t.Fatalf("expected %s written before close, got %s %v", want, data, err)
+			}
+		}
+		if _, err := a.Read(ctx); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected EOF after delivered messages, got %v", err)
+		}
+	})
+}
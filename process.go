@@ -0,0 +1,210 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ProcessOption configures StartProcess.
+type ProcessOption func(cfg *processConfig)
+
+type processConfig struct {
+	handler     Handler
+	stderr      func(line string)
+	exitMethod  string
+	exitParams  any
+	readLimit   int64
+	peerOptions []PeerOption
+}
+
+// ProcessHandler serves the requests and notifications of the subprocess, e.g. log messages of a language server.
+// By default, requests are responded to with MethodNotFound.
+func ProcessHandler(h Handler) ProcessOption {
+	return func(cfg *processConfig) {
+		cfg.handler = h
+	}
+}
+
+// ProcessStderr is called with every line the subprocess writes to stderr, e.g. to forward it to a logger.
+func ProcessStderr(fn func(line string)) ProcessOption {
+	return func(cfg *processConfig) {
+		cfg.stderr = fn
+	}
+}
+
+// ProcessExitNotification sets the notification that Shutdown sends, "exit" without params by default.
+// An empty method disables the notification: the subprocess then only sees its stdin close.
+func ProcessExitNotification(method string, params any) ProcessOption {
+	return func(cfg *processConfig) {
+		cfg.exitMethod = method
+		cfg.exitParams = params
+	}
+}
+
+// ProcessReadLimit limits the size of payloads received from the subprocess, DefaultMaxBodySize by default.
+func ProcessReadLimit(n int64) ProcessOption {
+	return func(cfg *processConfig) {
+		cfg.readLimit = n
+	}
+}
+
+// ProcessPeerOptions configures the peer that talks to the subprocess.
+func ProcessPeerOptions(opts ...PeerOption) ProcessOption {
+	return func(cfg *processConfig) {
+		cfg.peerOptions = append(cfg.peerOptions, opts...)
+	}
+}
+
+// maxStderrTail is how much of the end of stderr a Process keeps.
+const maxStderrTail = 64 << 10
+
+// Process is a subprocess that serves JSON-RPC over its stdin and stdout, with Content-Length framing.
+type Process struct {
+	cmd   *exec.Cmd
+	cfg   processConfig
+	peer  *Peer
+	stdin io.Closer
+
+	stderrMu sync.Mutex
+	stderr   []byte
+
+	// closed when the process exited, and its output is read
+	done chan struct{}
+	err  error
+}
+
+// StartProcess starts the command, and talks JSON-RPC to it over its stdin and stdout.
+// The command must not have its Stdin, Stdout or Stderr set.
+// The process is supervised until it exits: stderr is collected, and pending calls fail when it exits.
+func StartProcess(cmd *exec.Cmd, opts ...ProcessOption) (*Process, error) {
+	cfg := processConfig{exitMethod: "exit"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &Process{
+		cmd:   cmd,
+		cfg:   cfg,
+		peer:  NewPeer(NewStdioConn(stdout, stdin, cfg.readLimit), cfg.handler, cfg.peerOptions...),
+		stdin: stdin,
+		done:  make(chan struct{}),
+	}
+	go p.supervise(stderr)
+	return p, nil
+}
+
+// supervise reads the output of the process until it exits.
+func (p *Process) supervise(stderr io.Reader) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.readStderr(stderr)
+	}()
+	runErr := p.peer.Run(context.Background())
+	// stdout may be closed before the process exits, e.g. when the peer fails,
+	// so stdin is closed too, to let the process exit
+	_ = p.peer.Close()
+	// all reads from the pipes must be done before waiting for the command
+	wg.Wait()
+	p.err = p.cmd.Wait()
+	if p.err == nil && runErr != nil && !errors.Is(runErr, io.EOF) {
+		p.err = runErr
+	}
+	close(p.done)
+}
+
+func (p *Process) readStderr(r io.Reader) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			p.stderrMu.Lock()
+			p.stderr = append(p.stderr, line...)
+			if over := len(p.stderr) - maxStderrTail; over > 0 {
+				p.stderr = append(p.stderr[:0], p.stderr[over:]...)
+			}
+			p.stderrMu.Unlock()
+			if p.cfg.stderr != nil {
+				p.cfg.stderr(strings.TrimRight(line, "\r\n"))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Peer returns the peer to call and notify the subprocess with.
+func (p *Process) Peer() *Peer {
+	return p.peer
+}
+
+// Call calls the subprocess, see Peer.Call.
+func (p *Process) Call(ctx context.Context, method string, params any, result any) error {
+	return p.peer.Call(ctx, method, params, result)
+}
+
+// Notify notifies the subprocess, see Peer.Notify.
+func (p *Process) Notify(ctx context.Context, method string, params any) error {
+	return p.peer.Notify(ctx, method, params)
+}
+
+// Stderr returns the end of what the subprocess wrote to stderr so far.
+func (p *Process) Stderr() string {
+	p.stderrMu.Lock()
+	defer p.stderrMu.Unlock()
+	return string(p.stderr)
+}
+
+// Done is closed when the process exited.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the process to exit, and returns why it exited, like exec.Cmd.Wait does.
+// A protocol error is returned if the process exited successfully after it.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Shutdown sends the exit notification, closes stdin, and waits for the process to exit.
+// If the context is done first, the process is killed, and the context error is returned.
+func (p *Process) Shutdown(ctx context.Context) error {
+	if p.cfg.exitMethod != "" {
+		if err := p.peer.Notify(ctx, p.cfg.exitMethod, p.cfg.exitParams); err != nil && !errors.Is(err, ErrPeerClosed) {
+			_ = p.cmd.Process.Kill()
+			<-p.done
+			return err
+		}
+	}
+	_ = p.stdin.Close()
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		_ = p.cmd.Process.Kill()
+		<-p.done
+		return ctx.Err()
+	}
+}
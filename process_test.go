@@ -0,0 +1,164 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const stdioServerEnv = "JSONRPC_TEST_STDIO_SERVER"
+
+// TestStdioServerProcess is not a test, but the subprocess server of TestProcess.
+func TestStdioServerProcess(t *testing.T) {
+	mode := os.Getenv(stdioServerEnv)
+	if mode == "" {
+		t.Skip("only runs as subprocess")
+	}
+	h := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		switch req.Method {
+		case "exit":
+			fmt.Fprintln(os.Stderr, "exiting")
+			if mode != "stubborn" {
+				os.Exit(0)
+			}
+			return nil
+		case "log":
+			fmt.Fprintln(os.Stderr, "hello stderr")
+			return req.Respond(true)
+		case "crash":
+			fmt.Fprintln(os.Stderr, "crashing")
+			os.Exit(3)
+		case "ask":
+			n, _ := NotifierFromContext(ctx)
+			if err := n.Notify(ctx, "question", []string{"ping"}); err != nil {
+				return req.RespondErr(AsErrorObj(err))
+			}
+			return req.Respond(true)
+		}
+		return specHandler(ctx, req)
+	})
+	if mode == "stubborn" {
+		// ignore stdin closing too
+		_ = ServeStdio(context.Background(), h)
+		select {}
+	}
+	if err := ServeStdio(context.Background(), h); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func startTestProcess(t *testing.T, mode string, opts ...ProcessOption) *Process {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestStdioServerProcess$")
+	cmd.Env = append(os.Environ(), stdioServerEnv+"="+mode)
+	p, err := StartProcess(cmd, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		<-p.Done()
+	})
+	return p
+}
+
+func TestProcess(t *testing.T) {
+	t.Run("call and shutdown", func(t *testing.T) {
+		var mu sync.Mutex
+		var lines []string
+		p := startTestProcess(t, "serve", ProcessStderr(func(line string) {
+			mu.Lock()
+			lines = append(lines, line)
+			mu.Unlock()
+		}))
+		var result int
+		if err := p.Call(context.Background(), "subtract", []int{42, 23}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 19 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+		if err := p.Call(context.Background(), "log", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := p.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if stderr := p.Stderr(); !strings.Contains(stderr, "hello stderr\n") || !strings.Contains(stderr, "exiting\n") {
+			t.Fatalf("unexpected stderr: %q", stderr)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Join(lines, "|") != "hello stderr|exiting" {
+			t.Fatalf("unexpected stderr lines: %q", lines)
+		}
+	})
+	t.Run("custom exit notification", func(t *testing.T) {
+		p := startTestProcess(t, "serve", ProcessExitNotification("", nil))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// without notification, the server exits when stdin closes
+		if err := p.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(p.Stderr(), "exiting") {
+			t.Fatal("unexpected exit notification")
+		}
+	})
+	t.Run("kill", func(t *testing.T) {
+		p := startTestProcess(t, "stubborn")
+		if err := p.Call(context.Background(), "subtract", []int{2, 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+		var exitErr *exec.ExitError
+		if err := p.Wait(); !errors.As(err, &exitErr) {
+			t.Fatalf("expected exit error, got %v", err)
+		}
+	})
+	t.Run("crash", func(t *testing.T) {
+		p := startTestProcess(t, "serve")
+		if err := p.Call(context.Background(), "crash", nil, nil); !errors.Is(err, ErrPeerClosed) {
+			t.Fatalf("expected closed peer, got %v", err)
+		}
+		var exitErr *exec.ExitError
+		if err := p.Wait(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+			t.Fatalf("expected exit code 3, got %v", err)
+		}
+		if !strings.Contains(p.Stderr(), "crashing") {
+			t.Fatalf("unexpected stderr: %q", p.Stderr())
+		}
+	})
+	t.Run("handler", func(t *testing.T) {
+		questions := make(chan string, 1)
+		p := startTestProcess(t, "serve", ProcessHandler(HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			questions <- string(req.Params)
+			return nil
+		})))
+		if err := p.Call(context.Background(), "ask", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case q := <-questions:
+			if q != `["ping"]` {
+				t.Fatalf("unexpected params: %s", q)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package jsonrpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachePolicy configures the HTTP caching of the success responses of a method, see RESTCache.
+type CachePolicy struct {
+	// MaxAge is how long the response may be cached.
+	MaxAge time.Duration
+	// SharedMaxAge is how long shared caches, such as CDNs, may cache the response, if different from MaxAge.
+	SharedMaxAge time.Duration
+	// StaleWhileRevalidate is how long a stale response may be served while it is revalidated.
+	StaleWhileRevalidate time.Duration
+	// Immutable marks responses that never change, e.g. of finalized blocks.
+	Immutable bool
+	// Private keeps shared caches from caching the response, e.g. if it depends on the client.
+	Private bool
+}
+
+// CacheControl returns the Cache-Control header value of the policy.
+func (p CachePolicy) CacheControl() string {
+	var b strings.Builder
+	if p.Private {
+		b.WriteString("private")
+	} else {
+		b.WriteString("public")
+	}
+	b.WriteString(", max-age=")
+	b.WriteString(strconv.FormatInt(int64(p.MaxAge/time.Second), 10))
+	if p.SharedMaxAge > 0 && !p.Private {
+		b.WriteString(", s-maxage=")
+		b.WriteString(strconv.FormatInt(int64(p.SharedMaxAge/time.Second), 10))
+	}
+	if p.StaleWhileRevalidate > 0 {
+		b.WriteString(", stale-while-revalidate=")
+		b.WriteString(strconv.FormatInt(int64(p.StaleWhileRevalidate/time.Second), 10))
+	}
+	if p.Immutable {
+		b.WriteString(", immutable")
+	}
+	return b.String()
+}
+
+// RESTOption configures NewRESTGateway.
+type RESTOption func(cfg *restConfig)
+
+type restConfig struct {
+	prefix    string
+	allowed   map[string]bool
+	cache     map[string]CachePolicy
+	cacheFunc func(req *Message) (CachePolicy, bool)
+	status    func(obj *ErrorObject) int
+}
+
+// RESTPrefix sets the path prefix before the method name, "/rpc/" by default.
+func RESTPrefix(prefix string) RESTOption {
+	return func(cfg *restConfig) {
+		cfg.prefix = prefix
+	}
+}
+
+// RESTAllowMethods exposes the given methods over GET, others are not found.
+// No methods are exposed by default: GET requests can be made cross-site, without CORS preflight,
+// so only methods without side effects should be allowed.
+func RESTAllowMethods(methods ...string) RESTOption {
+	return func(cfg *restConfig) {
+		if cfg.allowed == nil {
+			cfg.allowed = make(map[string]bool)
+		}
+		for _, m := range methods {
+			cfg.allowed[m] = true
+		}
+	}
+}
+
+// RESTCache sets the caching policy of the success responses of the method.
+// Responses of methods without policy, and error responses, are not cached.
+func RESTCache(method string, policy CachePolicy) RESTOption {
+	return func(cfg *restConfig) {
+		if cfg.cache == nil {
+			cfg.cache = make(map[string]CachePolicy)
+		}
+		cfg.cache[method] = policy
+	}
+}
+
+// RESTCacheFunc sets a function that picks the caching policy by request, e.g. to only cache a block by number
+// and not by tag. It is used for methods without RESTCache policy. The response is not cached if it returns false.
+func RESTCacheFunc(fn func(req *Message) (CachePolicy, bool)) RESTOption {
+	return func(cfg *restConfig) {
+		cfg.cacheFunc = fn
+	}
+}
+
+// RESTStatusFunc overrides how error responses map to HTTP status codes, ErrorObject.HTTPStatus by default.
+func RESTStatusFunc(fn func(obj *ErrorObject) int) RESTOption {
+	return func(cfg *restConfig) {
+		cfg.status = fn
+	}
+}
+
+// restRequestID is the ID of the requests of the gateway, so responses of the same call are identical, for caching.
+const restRequestID RawID = "1"
+
+// RESTGateway translates HTTP GET requests into JSON-RPC calls, for curl and CDN caching:
+//
+//	GET /rpc/eth_getBlockByNumber?params=["0x1",false]
+//	GET /rpc/eth_getBlockByNumber/0x1/false
+//
+// Only the methods of RESTAllowMethods are exposed.
+// The params query parameter holds the JSON params, a list or map.
+// Alternatively, path segments after the method are positional params:
+// a segment that is valid JSON is used as-is, e.g. false or 12, and any other non-empty segment as string, e.g. 0x1.
+//
+// The response body is the JSON-RPC response. Error responses get the HTTP status of their code,
+// see ErrorObject.HTTPStatus. Success responses get caching headers from the policy of the method, and an ETag.
+type RESTGateway struct {
+	handler Handler
+	cfg     restConfig
+}
+
+var _ http.Handler = (*RESTGateway)(nil)
+
+// NewRESTGateway creates an http.Handler that translates GET requests into calls of the handler.
+func NewRESTGateway(h Handler, opts ...RESTOption) *RESTGateway {
+	cfg := restConfig{
+		prefix: "/rpc/",
+		status: (*ErrorObject).HTTPStatus,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &RESTGateway{handler: h, cfg: cfg}
+}
+
+func (g *RESTGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed, use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	req, err := g.request(r)
+	if err != nil {
+		g.writeResponse(w, r, errorResponse(restRequestID, err), nil)
+		return
+	}
+	if !g.cfg.allowed[req.Method] {
+		g.writeResponse(w, r, req.RespondErr(ConstErrorObj(MethodNotFound)), nil)
+		return
+	}
+	resp := callHandler(r.Context(), g.handler, req)
+	g.writeResponse(w, r, resp, req)
+}
+
+// request translates the HTTP request into a JSON-RPC request.
+func (g *RESTGateway) request(r *http.Request) (*Message, error) {
+	path, ok := strings.CutPrefix(r.URL.EscapedPath(), g.cfg.prefix)
+	if !ok || path == "" {
+		return nil, &MessageError{Code: MethodNotFound, Err: errors.New("missing method in path")}
+	}
+	segments := strings.Split(path, "/")
+	method, err := pathUnescape(segments[0])
+	if err != nil {
+		return nil, invalidRequest(err)
+	}
+	if method == "" {
+		return nil, &MessageError{Code: MethodNotFound, Err: errors.New("missing method in path")}
+	}
+	var params Params
+	query := r.URL.Query()
+	if query.Has("params") {
+		if len(segments) > 1 {
+			return nil, &MessageError{Code: InvalidParams, Err: errors.New("params must be either in the query or in the path")}
+		}
+		raw := strings.TrimSpace(query.Get("params"))
+		if raw == "" || (raw[0] != '[' && raw[0] != '{') || !json.Valid([]byte(raw)) {
+			return nil, &MessageError{Code: InvalidParams, Err: errors.New("params must be a JSON list or map")}
+		}
+		params = Params(raw)
+	} else if len(segments) > 1 {
+		list := []byte{'['}
+		for i, seg := range segments[1:] {
+			if seg == "" {
+				return nil, &MessageError{Code: InvalidParams, Err: errors.New("empty param in path")}
+			}
+			v, err := pathUnescape(seg)
+			if err != nil {
+				return nil, &MessageError{Code: InvalidParams, Err: err}
+			}
+			if i > 0 {
+				list = append(list, ',')
+			}
+			if json.Valid([]byte(v)) {
+				list = append(list, strings.TrimSpace(v)...)
+			} else {
+				str, _ := json.Marshal(v)
+				list = append(list, str...)
+			}
+		}
+		params = Params(append(list, ']'))
+	}
+	return &Message{Request: &Request{Method: method, Params: params}, ID: restRequestID}, nil
+}
+
+func pathUnescape(s string) (string, error) {
+	v, err := url.PathUnescape(s)
+	if err != nil {
+		return "", errors.New("invalid path escape")
+	}
+	return v, nil
+}
+
+// writeResponse writes the response, with caching headers for success responses of the request, if any.
+func (g *RESTGateway) writeResponse(w http.ResponseWriter, r *http.Request, resp *Message, req *Message) {
+	data := encodeResponse(resp)
+	h := w.Header()
+	if resp.Response.IsError() {
+		h.Set("Cache-Control", "no-store")
+		writeJSON(w, g.cfg.status(resp.Error), data)
+		return
+	}
+	policy, ok := g.cachePolicy(req)
+	if !ok {
+		h.Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, data)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	h.Set("Cache-Control", policy.CacheControl())
+	h.Set("ETag", etag)
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+func (g *RESTGateway) cachePolicy(req *Message) (CachePolicy, bool) {
+	if req == nil {
+		return CachePolicy{}, false
+	}
+	if policy, ok := g.cfg.cache[req.Method]; ok {
+		return policy, true
+	}
+	if g.cfg.cacheFunc != nil {
+		return g.cfg.cacheFunc(req)
+	}
+	return CachePolicy{}, false
+}
+
+// etagMatch checks if the If-None-Match header value matches the strong ETag.
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package jsonrpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRESTGateway(t *testing.T) {
+	h := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		switch req.Method {
+		case "echo":
+			if req.Params == nil {
+				return req.Respond(nil)
+			}
+			return req.Respond(req.Params)
+		case "limited":
+			return req.RespondErr(ConstErrorObj(LimitExceeded))
+		}
+		return specHandler(ctx, req)
+	})
+	get := func(t *testing.T, gw http.Handler, target string, header http.Header) (*http.Response, string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, r)
+		resp := w.Result()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	allow := RESTAllowMethods("subtract", "echo", "limited")
+
+	t.Run("query params", func(t *testing.T) {
+		gw := NewRESTGateway(h, allow)
+		resp, body := get(t, gw, `/rpc/subtract?params=[42,23]`, nil)
+		if resp.StatusCode != http.StatusOK || body != `{"result":19,"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+		}
+		if resp.Header.Get("Content-Type") != "application/json" || resp.Header.Get("Cache-Control") != "no-store" {
+			t.Fatalf("unexpected headers: %v", resp.Header)
+		}
+		if _, body = get(t, gw, `/rpc/echo?params={"a":1}`, nil); body != `{"result":{"a":1},"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected response: %s", body)
+		}
+		if _, body = get(t, gw, `/rpc/echo`, nil); body != `{"result":null,"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected response: %s", body)
+		}
+	})
+	t.Run("path params", func(t *testing.T) {
+		gw := NewRESTGateway(h, allow)
+		_, body := get(t, gw, `/rpc/echo/0x1/false/12/%22q%22/a%2Fb/%7B%22a%22:1%7D`, nil)
+		if body != `{"result":["0x1",false,12,"q","a/b",{"a":1}],"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected response: %s", body)
+		}
+		if _, body = get(t, NewRESTGateway(h, allow, RESTPrefix("/api/v1/")), `/api/v1/subtract/42/23`, nil); body != `{"result":19,"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected response: %s", body)
+		}
+	})
+	t.Run("caching", func(t *testing.T) {
+		gw := NewRESTGateway(h, allow,
+			RESTCache("subtract", CachePolicy{MaxAge: time.Minute, SharedMaxAge: time.Hour, Immutable: true}),
+			RESTCache("limited", CachePolicy{MaxAge: time.Minute}),
+			RESTCacheFunc(func(req *Message) (CachePolicy, bool) {
+				first, _ := req.Params.At(0)
+				return CachePolicy{MaxAge: 10 * time.Second, StaleWhileRevalidate: 5 * time.Second, Private: true}, string(first) != `"latest"`
+			}),
+		)
+		resp, _ := get(t, gw, `/rpc/subtract/42/23`, nil)
+		if cc := resp.Header.Get("Cache-Control"); cc != "public, max-age=60, s-maxage=3600, immutable" {
+			t.Fatalf("unexpected Cache-Control: %s", cc)
+		}
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			t.Fatal("missing ETag")
+		}
+		resp, body := get(t, gw, `/rpc/subtract?params=[42,23]`, http.Header{"If-None-Match": {`"other", ` + etag}})
+		if resp.StatusCode != http.StatusNotModified || body != "" {
+			t.Fatalf("expected not modified, got %d %s", resp.StatusCode, body)
+		}
+		if resp, _ = get(t, gw, `/rpc/subtract/42/22`, http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected changed response, got %d", resp.StatusCode)
+		}
+		if resp, _ = get(t, gw, `/rpc/echo/0x1`, nil); resp.Header.Get("Cache-Control") != "private, max-age=10, stale-while-revalidate=5" {
+			t.Fatalf("unexpected Cache-Control: %s", resp.Header.Get("Cache-Control"))
+		}
+		if resp, _ = get(t, gw, `/rpc/echo/latest`, nil); resp.Header.Get("Cache-Control") != "no-store" || resp.Header.Get("ETag") != "" {
+			t.Fatalf("unexpected headers: %v", resp.Header)
+		}
+		// errors are not cached
+		if resp, _ = get(t, gw, `/rpc/limited`, nil); resp.Header.Get("Cache-Control") != "no-store" {
+			t.Fatalf("unexpected Cache-Control: %s", resp.Header.Get("Cache-Control"))
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		gw := NewRESTGateway(h, allow, RESTAllowMethods("foo.get"))
+		for _, tc := range []struct {
+			target string
+			status int
+			code   ErrorConst
+		}{
+			{`/rpc/foo.get`, http.StatusNotFound, MethodNotFound},
+			{`/rpc/`, http.StatusNotFound, MethodNotFound},
+			{`/rpc//1`, http.StatusNotFound, MethodNotFound},
+			{`/rpc/echo/`, http.StatusBadRequest, InvalidParams},
+			{`/rpc/echo/1//2`, http.StatusBadRequest, InvalidParams},
+			{`/other/subtract`, http.StatusNotFound, MethodNotFound},
+			{`/rpc/subtract?params=42`, http.StatusBadRequest, InvalidParams},
+			{`/rpc/subtract?params=[42`, http.StatusBadRequest, InvalidParams},
+			{`/rpc/subtract/1?params=[2]`, http.StatusBadRequest, InvalidParams},
+			{`/rpc/limited`, http.StatusTooManyRequests, LimitExceeded},
+		} {
+			resp, body := get(t, gw, tc.target, nil)
+			if resp.StatusCode != tc.status {
+				t.Fatalf("%s: expected status %d, got %d", tc.target, tc.status, resp.StatusCode)
+			}
+			msg, err := DecodeMessage([]byte(body))
+			if err != nil {
+				t.Fatalf("%s: %v", tc.target, err)
+			}
+			if !msg.Response.IsError() || msg.Error.Code != tc.code.Code() || msg.ID != "1" {
+				t.Fatalf("%s: unexpected response: %s", tc.target, body)
+			}
+		}
+		custom := NewRESTGateway(h, allow, RESTStatusFunc(func(obj *ErrorObject) int { return http.StatusOK }))
+		if resp, _ := get(t, custom, `/rpc/limited`, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected custom status, got %d", resp.StatusCode)
+		}
+		r := httptest.NewRequest(http.MethodPost, `/rpc/subtract`, nil)
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, r)
+		if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+			t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+		}
+	})
+	t.Run("allow methods", func(t *testing.T) {
+		// no methods are exposed by default
+		if resp, _ := get(t, NewRESTGateway(h), `/rpc/subtract/2/1`, nil); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected not found, got %d", resp.StatusCode)
+		}
+		gw := NewRESTGateway(h, RESTAllowMethods("subtract"))
+		if resp, _ := get(t, gw, `/rpc/subtract/2/1`, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status: %d", resp.StatusCode)
+		}
+		if resp, _ := get(t, gw, `/rpc/echo/1`, nil); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected not found, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestErrorHTTPStatus(t *testing.T) {
+	for _, tc := range []struct {
+		code   ErrorConst
+		status int
+	}{
+		{ParseErr, http.StatusBadRequest},
+		{InvalidRequest, http.StatusBadRequest},
+		{MethodNotFound, http.StatusNotFound},
+		{InvalidParams, http.StatusBadRequest},
+		{InternalError, http.StatusInternalServerError},
+		{ResourceNotFound, http.StatusNotFound},
+		{ResourceUnavailable, http.StatusServiceUnavailable},
+		{MethodNotSupported, http.StatusNotImplemented},
+		{LimitExceeded, http.StatusTooManyRequests},
+		{Unauthorized, http.StatusUnauthorized},
+		{ErrorConst(-32050), http.StatusInternalServerError},
+		{ErrorConst(3), http.StatusInternalServerError},
+	} {
+		if got := tc.code.HTTPStatus(); got != tc.status {
+			t.Fatalf("%d: expected %d, got %d", tc.code, tc.status, got)
+		}
+		if got := ConstErrorObj(tc.code).HTTPStatus(); got != tc.status {
+			t.Fatalf("%d: expected %d from error object, got %d", tc.code, tc.status, got)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 )
 
 type RawID string
@@ -87,16 +88,9 @@ func (p *Params) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Count returns the number of params, or 0 if the params are invalid. Alias of Len.
 func (p Params) Count() int {
-	var x []json.RawMessage
-	if err := json.Unmarshal(p, &x); err == nil {
-		return len(x)
-	}
-	var y map[string]json.RawMessage
-	if err := json.Unmarshal(p, &y); err == nil {
-		return len(y)
-	}
-	return 0
+	return p.Len()
 }
 
 type Request struct {
@@ -111,11 +105,48 @@ type ErrorObject struct {
 	Data    json.RawMessage `json:"data,omitempty"`
 }
 
+// Error implements the error interface, so error responses can be returned as errors.
+func (e *ErrorObject) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// HTTPStatus maps the error code to an HTTP status code, see ErrorConst.HTTPStatus.
+func (e *ErrorObject) HTTPStatus() int {
+	return ErrorConst(e.Code).HTTPStatus()
+}
+
+// Response is either a success response with a Result, or an error response with an Error, never both.
+// A `"result": null` member decodes as a Result holding `null`, and a nil Result without Error encodes as null result.
+// Responses with both members, or with `"error": null`, are rejected when decoding, unless LenientResponses is used.
 type Response struct {
 	Result *json.RawMessage `json:"result,omitempty"`
 	Error  *ErrorObject     `json:"error,omitempty"`
 }
 
+var nullResult = json.RawMessage("null")
+
+// IsSuccess checks if the response has no error. The result may be null.
+func (r *Response) IsSuccess() bool {
+	return r != nil && r.Error == nil
+}
+
+// IsError checks if the response has an error.
+func (r *Response) IsError() bool {
+	return r != nil && r.Error != nil
+}
+
+// RawResult returns the result of a success response, `null` if the result is null or nil.
+// It returns nil for error responses.
+func (r *Response) RawResult() json.RawMessage {
+	if !r.IsSuccess() {
+		return nil
+	}
+	if r.Result == nil {
+		return nullResult
+	}
+	return *r.Result
+}
+
 // V2 is a zero-cost constant type, for encoding/decoding JSON-RPC messages:
 // it validates the JSON-RPC version, without allocating it as Go string in every message.
 type V2 struct{}
@@ -137,6 +168,9 @@ type Message struct {
 	*Request
 	*Response
 	ID RawID // "notification" messages do not require an ID
+	// Extensions holds non-standard top-level members, such as trace context or routing hints.
+	// Keys must not match standard members.
+	Extensions map[string]json.RawMessage
 }
 
 type jsonMessage struct {
@@ -146,26 +180,103 @@ type jsonMessage struct {
 	JSONRPC V2    `json:"jsonrpc"`
 }
 
+// MessageKind classifies a message.
+type MessageKind int
+
+const (
+	// KindInvalid is a message that is neither a valid request nor a valid response.
+	KindInvalid MessageKind = iota
+	KindRequest
+	KindNotification
+	KindSuccessResponse
+	KindErrorResponse
+)
+
+func (k MessageKind) String() string {
+	switch k {
+	case KindRequest:
+		return "request"
+	case KindNotification:
+		return "notification"
+	case KindSuccessResponse:
+		return "success response"
+	case KindErrorResponse:
+		return "error response"
+	default:
+		return "invalid"
+	}
+}
+
+func messageKind(isRequest, isResponse, isNotification, isError bool) MessageKind {
+	switch {
+	case checkMessage(isRequest, isResponse, isNotification) != nil:
+		return KindInvalid
+	case isResponse && isError:
+		return KindErrorResponse
+	case isResponse:
+		return KindSuccessResponse
+	case isNotification:
+		return KindNotification
+	default:
+		return KindRequest
+	}
+}
+
+// Kind classifies the message as request, notification, success response or error response.
+func (m *Message) Kind() MessageKind {
+	return messageKind(m.Request != nil, m.Response != nil, m.ID.IsNotification(), m.Response.IsError())
+}
+
+// Check checks that the message is either a request or a response, and returns a MessageError if not.
 func (m *jsonMessage) Check() error {
-	if m.Response != nil {
-		if m.Request != nil {
-			return errors.New("message must be either a request or response, but not both")
+	return checkMessage(m.Request != nil, m.Response != nil, m.ID.IsNotification())
+}
+
+func checkMessage(isRequest, isResponse, isNotification bool) error {
+	if isResponse {
+		if isRequest {
+			return invalidRequest(errors.New("message must be either a request or response, but not both"))
 		}
-		if m.ID.IsNotification() {
-			return errors.New("responses cannot be notifications")
+		if isNotification {
+			return invalidRequest(errors.New("responses cannot be notifications"))
 		}
 	} else {
-		if m.Request == nil {
-			return errors.New("message must be either a request or response")
+		if !isRequest {
+			return invalidRequest(errors.New("message must be either a request or response"))
 		}
 	}
 	return nil
 }
 
+// checkResponse checks the raw result and error members of a response, nil if absent,
+// and returns which of them make up the response.
+// If lenient, a null error is ignored, and an error takes precedence over a result.
+func checkResponse(result, errObj []byte, lenient bool) (useResult, useError bool, err error) {
+	if errObj != nil && isNull(errObj) {
+		if !lenient || result == nil {
+			return false, false, invalidRequest(errors.New("response error must not be null"))
+		}
+		errObj = nil
+	}
+	if result != nil && errObj != nil && !lenient {
+		return false, false, invalidRequest(errors.New("response must not have both result and error"))
+	}
+	return errObj == nil, errObj != nil, nil
+}
+
 func (m *Message) MarshalJSON() ([]byte, error) {
+	resp := m.Response
+	if resp != nil {
+		if resp.Result != nil && resp.Error != nil {
+			return nil, errors.New("response must not have both result and error")
+		}
+		if resp.Result == nil && resp.Error == nil {
+			resp = &Response{Result: &nullResult}
+		}
+	}
 	out := jsonMessage{
 		Request:  m.Request,
-		Response: m.Response,
+		Response: resp,
 		ID:       m.ID,
 		JSONRPC:  V2{},
 	}
@@ -173,24 +284,61 @@ func (m *Message) MarshalJSON() ([]byte, error) {
 	if err != nil {
 		return data, err
 	}
-	return data, out.Check()
+	if err := out.Check(); err != nil {
+		return data, err
+	}
+	return appendExtensions(data, m.Extensions)
 }
 
 func (m *Message) UnmarshalJSON(data []byte) error {
-	var dest jsonMessage
-	err := json.Unmarshal(data, &dest)
+	return m.decode(data, &messageConfig{})
+}
+
+// NewRequest creates a request message.
+// The params are encoded like ParamsEncoder does by default: structs become positional params.
+// Pre-encoded Params are used as-is, e.g. to send named params produced with the NamedParams option.
+func NewRequest(id RawID, method string, params any) (*Message, error) {
+	if id.IsNotification() {
+		return nil, errors.New("request must have an ID, use NewNotification for notifications")
+	}
+	if !id.IsValid() {
+		return nil, fmt.Errorf("invalid ID: %x", []byte(id))
+	}
+	req, err := newRequest(method, params)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := dest.Check(); err != nil {
-		return err
+	return &Message{
+		Request:  req,
+		Response: nil,
+		ID:       id,
+	}, nil
+}
+
+// NewNotification creates a request message without ID, which the receiver does not respond to.
+// The params are encoded the same as with NewRequest.
+func NewNotification(method string, params any) (*Message, error) {
+	req, err := newRequest(method, params)
+	if err != nil {
+		return nil, err
 	}
-	*m = Message{
-		Request:  dest.Request,
-		Response: dest.Response,
-		ID:       dest.ID,
+	return &Message{
+		Request:  req,
+		Response: nil,
+		ID:       "",
+	}, nil
+}
+
+func newRequest(method string, params any) (*Request, error) {
+	var cfg encoderConfig
+	p, err := cfg.encode(reflect.ValueOf(params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode params: %w", err)
 	}
-	return nil
+	return &Request{
+		Method: method,
+		Params: p,
+	}, nil
 }
 
 func (m *Message) RespondSuccess(data any) (*Message, error) {
@@ -247,6 +395,30 @@ func AnnotatedErrorObj(c ErrorConst, err error) *ErrorObject {
 	}
 }
 
+// AsErrorObj converts the error into an error object to respond with.
+// An ErrorObject is used as-is.
+// Errors with an ErrorObject method, such as ParamsError and MessageError, provide their own error object,
+// errors that implement Error, such as ErrorConst, are used as-is, and other errors are annotated as InternalError.
+func AsErrorObj(err error) *ErrorObject {
+	var obj *ErrorObject
+	if errors.As(err, &obj) {
+		return obj
+	}
+	var objErr interface{ ErrorObject() *ErrorObject }
+	if errors.As(err, &objErr) {
+		return objErr.ErrorObject()
+	}
+	var codeErr Error
+	if errors.As(err, &codeErr) {
+		return &ErrorObject{
+			Code:    codeErr.Code(),
+			Message: codeErr.Message(),
+			Data:    nil,
+		}
+	}
+	return AnnotatedErrorObj(InternalError, err)
+}
+
 func (m *Message) Respond(data any) *Message {
 	if m.Response != nil {
 		panic(fmt.Errorf("cannot respond to a response: %s", m.ID))
@@ -2,6 +2,7 @@ package jsonrpc
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -119,3 +120,297 @@ func TestRPC(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRequest(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		m, err := NewRequest("1", "subtract", TestObj{Foo: "hello", Bar: 1234})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != `{"method":"subtract","params":["hello",1234],"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected request: %s", out)
+		}
+	})
+	t.Run("named params", func(t *testing.T) {
+		p, err := ParamsEncoder[TestObj](NamedParams())(TestObj{Foo: "hello", Bar: 1234})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := NewRequest(`"a"`, "subtract", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(m.Params) != `{"foo":"hello","bar":1234}` {
+			t.Fatalf("unexpected params: %s", m.Params)
+		}
+	})
+	t.Run("request without ID", func(t *testing.T) {
+		if _, err := NewRequest("", "foobar", nil); err == nil {
+			t.Fatal("expected error for request without ID")
+		}
+	})
+	t.Run("invalid ID", func(t *testing.T) {
+		if _, err := NewRequest("1.5", "foobar", nil); err == nil {
+			t.Fatal("expected error for invalid ID")
+		}
+	})
+	t.Run("notification", func(t *testing.T) {
+		m, err := NewNotification("update", []int{1, 2, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != `{"method":"update","params":[1,2,3],"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected notification: %s", out)
+		}
+	})
+	t.Run("invalid params", func(t *testing.T) {
+		if _, err := NewNotification("update", 123); err == nil {
+			t.Fatal("expected error for non-structured params")
+		}
+	})
+}
+
+func TestMessageExtensions(t *testing.T) {
+	const data = `{"jsonrpc": "2.0", "method": "eth_call", "id": 1, "traceparent": "00-abc-01", "x-route": {"shard": 3}}`
+	t.Run("preserved", func(t *testing.T) {
+		var m Message
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Extensions) != 2 || string(m.Extensions["traceparent"]) != `"00-abc-01"` ||
+			string(m.Extensions["x-route"]) != `{"shard": 3}` {
+			t.Fatalf("unexpected extensions: %v", m.Extensions)
+		}
+		out, err := json.Marshal(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const expected = `{"method":"eth_call","id":1,"jsonrpc":"2.0","traceparent":"00-abc-01","x-route":{"shard":3}}`
+		if string(out) != expected {
+			t.Fatalf("unexpected encoding: %s", out)
+		}
+	})
+	t.Run("none", func(t *testing.T) {
+		var m Message
+		if err := json.Unmarshal([]byte(`{"jsonrpc": "2.0", "method": "foo", "METHOD": "bar"}`), &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Extensions != nil {
+			t.Fatalf("unexpected extensions: %v", m.Extensions)
+		}
+	})
+	t.Run("reject unknown members", func(t *testing.T) {
+		if _, err := DecodeMessage([]byte(data), RejectUnknownMembers()); err == nil {
+			t.Fatal("expected error for unknown members")
+		}
+		m, err := DecodeMessage([]byte(`{"jsonrpc": "2.0", "method": "foo"}`), RejectUnknownMembers())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Method != "foo" {
+			t.Fatal("unexpected method")
+		}
+	})
+	t.Run("conflicting extension", func(t *testing.T) {
+		m := &Message{
+			Request:    &Request{Method: "foo"},
+			Extensions: map[string]json.RawMessage{"ID": json.RawMessage(`2`)},
+		}
+		if _, err := json.Marshal(m); err == nil {
+			t.Fatal("expected error for extension that conflicts with standard member")
+		}
+	})
+	t.Run("invalid extension", func(t *testing.T) {
+		m := &Message{
+			Request:    &Request{Method: "foo"},
+			Extensions: map[string]json.RawMessage{"x": json.RawMessage(`{`)},
+		}
+		if _, err := json.Marshal(m); err == nil {
+			t.Fatal("expected error for invalid extension")
+		}
+	})
+}
+
+func TestResponseSemantics(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		lenient bool
+		// expected result, empty for error responses
+		result string
+		// expected error code, if an error response
+		code int64
+		// expected decoding error
+		fail bool
+	}{
+		{name: "result", data: `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, result: `"0x1"`},
+		{name: "null result", data: `{"jsonrpc":"2.0","id":1,"result":null}`, result: `null`},
+		{name: "error", data: `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"x"}}`, code: -32000},
+		{name: "null error", data: `{"jsonrpc":"2.0","id":1,"error":null}`, fail: true},
+		{name: "null error lenient", data: `{"jsonrpc":"2.0","id":1,"error":null}`, lenient: true, fail: true},
+		{name: "both", data: `{"jsonrpc":"2.0","id":1,"result":"0x1","error":{"code":-32000,"message":"x"}}`, fail: true},
+		{name: "both lenient", data: `{"jsonrpc":"2.0","id":1,"result":"0x1","error":{"code":-32000,"message":"x"}}`, lenient: true, code: -32000},
+		{name: "null result and error", data: `{"jsonrpc":"2.0","id":1,"result":null,"error":{"code":-32000,"message":"x"}}`, fail: true},
+		{name: "null result and error lenient", data: `{"jsonrpc":"2.0","id":1,"result":null,"error":{"code":-32000,"message":"x"}}`, lenient: true, code: -32000},
+		{name: "result and null error", data: `{"jsonrpc":"2.0","id":1,"result":"0x1","error":null}`, fail: true},
+		{name: "result and null error lenient", data: `{"jsonrpc":"2.0","id":1,"result":"0x1","error":null}`, lenient: true, result: `"0x1"`},
+		{name: "null result and null error lenient", data: `{"jsonrpc":"2.0","id":1,"result":null,"error":null}`, lenient: true, result: `null`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []MessageOption
+			if tc.lenient {
+				opts = append(opts, LenientResponses())
+			}
+			m, err := DecodeMessage([]byte(tc.data), opts...)
+			if tc.fail {
+				if err == nil {
+					t.Fatal("expected decoding error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.code != 0 {
+				if !m.IsError() || m.IsSuccess() || m.Error.Code != tc.code || m.Result != nil || m.RawResult() != nil {
+					t.Fatalf("expected error response with code %d, got %+v", tc.code, m.Response)
+				}
+			} else if !m.IsSuccess() || m.IsError() || string(m.RawResult()) != tc.result {
+				t.Fatalf("expected success response with result %s, got %+v", tc.result, m.Response)
+			}
+			// normalized responses round-trip
+			out, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m2 Message
+			if err := json.Unmarshal(out, &m2); err != nil {
+				t.Fatalf("failed to decode %s: %v", out, err)
+			}
+			if string(m2.RawResult()) != string(m.RawResult()) || m2.IsError() != m.IsError() {
+				t.Fatalf("response changed after round-trip: %s", out)
+			}
+		})
+	}
+	t.Run("encode nil result", func(t *testing.T) {
+		out, err := json.Marshal(&Message{Response: &Response{}, ID: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != `{"result":null,"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected encoding: %s", out)
+		}
+	})
+	t.Run("encode both", func(t *testing.T) {
+		result := json.RawMessage(`1`)
+		m := &Message{Response: &Response{Result: &result, Error: ConstErrorObj(InternalError)}, ID: "1"}
+		if _, err := json.Marshal(m); err == nil {
+			t.Fatal("expected encoding error")
+		}
+	})
+	t.Run("scan", func(t *testing.T) {
+		var s ScannedMessage
+		if err := ScanMessage([]byte(`{"jsonrpc":"2.0","id":1,"result":null}`), &s); err != nil {
+			t.Fatal(err)
+		}
+		if string(s.Result) != "null" {
+			t.Fatalf("unexpected result: %q", s.Result)
+		}
+		if err := ScanMessage([]byte(`{"jsonrpc":"2.0","id":1,"error":null}`), &s); err == nil {
+			t.Fatal("expected error for null error")
+		}
+	})
+}
+
+func TestMessageKind(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		kind MessageKind
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"foo"}`, KindRequest},
+		{`{"jsonrpc":"2.0","method":"foo","params":[]}`, KindNotification},
+		{`{"jsonrpc":"2.0","id":1,"result":null}`, KindSuccessResponse},
+		{`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error"}}`, KindErrorResponse},
+	} {
+		m, err := DecodeMessage([]byte(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := m.Kind(); k != tc.kind {
+			t.Fatalf("expected %s for %s, got %s", tc.kind, tc.data, k)
+		}
+		lazy, err := ParseLazyMessage([]byte(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := lazy.Kind(); k != tc.kind {
+			t.Fatalf("expected lazy %s for %s, got %s", tc.kind, tc.data, k)
+		}
+	}
+	if k := (&Message{}).Kind(); k != KindInvalid {
+		t.Fatalf("expected invalid, got %s", k)
+	}
+	if k := (&Message{Request: &Request{Method: "foo"}, Response: &Response{}, ID: "1"}).Kind(); k != KindInvalid {
+		t.Fatalf("expected invalid, got %s", k)
+	}
+}
+
+func TestMessageErrorCodes(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		code ErrorConst
+	}{
+		{`{"jsonrpc":"2.0","method":"foo"`, ParseErr},
+		{`{"jsonrpc":"2.0","method":"foo"} x`, ParseErr},
+		{`{"jsonrpc":"2.0","method":"foo",}`, ParseErr},
+		{``, ParseErr},
+		{`[1]`, InvalidRequest},
+		{`"foo"`, InvalidRequest},
+		{`{"jsonrpc":"1.0","method":"foo"}`, InvalidRequest},
+		{`{"jsonrpc":"2.0","method":1}`, InvalidRequest},
+		{`{"jsonrpc":"2.0","method":"foo","params":"bar"}`, InvalidRequest},
+		{`{"jsonrpc":"2.0","id":1.5,"method":"foo"}`, InvalidRequest},
+		{`{"jsonrpc":"2.0","id":1}`, InvalidRequest},
+		{`{"jsonrpc":"2.0","method":"foo","result":1,"id":1}`, InvalidRequest},
+		{`{"jsonrpc":"2.0","result":1}`, InvalidRequest},
+		{`{"jsonrpc":"2.0","id":1,"error":{"code":"x","message":"m"}}`, InvalidRequest},
+	} {
+		_, err := DecodeMessage([]byte(tc.data))
+		var mErr *MessageError
+		if !errors.As(err, &mErr) {
+			t.Fatalf("expected MessageError for %q, got %v", tc.data, err)
+		}
+		if mErr.Code != tc.code || !errors.Is(err, tc.code) {
+			t.Fatalf("expected %d for %q, got %d: %v", tc.code, tc.data, mErr.Code, err)
+		}
+		if obj := mErr.ErrorObject(); obj.Code != tc.code.Code() {
+			t.Fatalf("unexpected error object code: %d", obj.Code)
+		}
+		var s ScannedMessage
+		if err := ScanMessage([]byte(tc.data), &s); !errors.Is(err, tc.code) {
+			t.Fatalf("expected scan error %d for %q, got %v", tc.code, tc.data, err)
+		}
+	}
+}
+
+func TestErrorConstError(t *testing.T) {
+	err := fmt.Errorf("unknown block: %w", ResourceNotFound)
+	if !errors.Is(err, ResourceNotFound) || errors.Is(err, InvalidParams) {
+		t.Fatalf("expected wrapped constant to match its code only: %v", err)
+	}
+	if err.Error() != "unknown block: Resource not found" {
+		t.Fatalf("unexpected error message: %s", err)
+	}
+	obj := AsErrorObj(err)
+	if obj.Code != ResourceNotFound.Code() || obj.Message != ResourceNotFound.Message() {
+		t.Fatalf("unexpected error object: %v", obj)
+	}
+}
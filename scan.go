@@ -0,0 +1,344 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maximum nesting depth of JSON values, same as encoding/json
+const maxScanDepth = 10000
+
+var errUnexpectedEnd = errors.New("unexpected end of JSON input")
+
+// The scan functions below parse JSON in a single pass, without allocating,
+// and return offsets into the original data, so sub-slices can be used as values.
+
+func scanSpace(data []byte, i int) int {
+	for i < len(data) && isSpace(data[i]) {
+		i++
+	}
+	return i
+}
+
+func scanSyntaxErr(data []byte, i int, what string) error {
+	if i >= len(data) {
+		return errUnexpectedEnd
+	}
+	return fmt.Errorf("invalid character %q %s at offset %d", data[i], what, i)
+}
+
+// scanValue returns the end offset of the JSON value that starts at data[i].
+// No whitespace is skipped.
+func scanValue(data []byte, i int) (int, error) {
+	return scanValueDepth(data, i, 0)
+}
+
+func scanValueDepth(data []byte, i int, depth int) (int, error) {
+	if i >= len(data) {
+		return i, errUnexpectedEnd
+	}
+	switch c := data[i]; {
+	case c == '"':
+		return scanString(data, i)
+	case c == '{' || c == '[':
+		if depth >= maxScanDepth {
+			return i, errors.New("exceeded max JSON nesting depth")
+		}
+		if c == '{' {
+			return scanObject(data, i, depth+1, nil)
+		}
+		return scanArray(data, i, depth+1, nil)
+	case c == '-' || (c >= '0' && c <= '9'):
+		return scanNumber(data, i)
+	case c == 't':
+		return scanLiteral(data, i, "true")
+	case c == 'f':
+		return scanLiteral(data, i, "false")
+	case c == 'n':
+		return scanLiteral(data, i, "null")
+	default:
+		return i, scanSyntaxErr(data, i, "looking for beginning of value")
+	}
+}
+
+func scanLiteral(data []byte, i int, lit string) (int, error) {
+	if !bytes.HasPrefix(data[i:], []byte(lit)) {
+		return i, fmt.Errorf("invalid literal at offset %d, expected %s", i, lit)
+	}
+	return i + len(lit), nil
+}
+
+// scanString returns the end offset of the JSON string that starts at data[i], including the closing quote.
+func scanString(data []byte, i int) (int, error) {
+	i++ // opening quote
+	for i < len(data) {
+		switch c := data[i]; {
+		case c == '"':
+			return i + 1, nil
+		case c == '\\':
+			i++
+			if i >= len(data) {
+				return i, errUnexpectedEnd
+			}
+			switch data[i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				i++
+			case 'u':
+				if i+5 > len(data) {
+					return i, errUnexpectedEnd
+				}
+				for _, h := range data[i+1 : i+5] {
+					if !isHexDigit(h) {
+						return i, fmt.Errorf("invalid unicode escape at offset %d", i)
+					}
+				}
+				i += 5
+			default:
+				return i, scanSyntaxErr(data, i, "in string escape code")
+			}
+		case c < 0x20:
+			return i, scanSyntaxErr(data, i, "in string literal")
+		default:
+			i++
+		}
+	}
+	return i, errUnexpectedEnd
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func scanDigits(data []byte, i int) int {
+	for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// scanNumber returns the end offset of the JSON number that starts at data[i].
+func scanNumber(data []byte, i int) (int, error) {
+	if data[i] == '-' {
+		i++
+	}
+	if i >= len(data) {
+		return i, errUnexpectedEnd
+	}
+	switch {
+	case data[i] == '0':
+		i++
+	case data[i] >= '1' && data[i] <= '9':
+		i = scanDigits(data, i+1)
+	default:
+		return i, scanSyntaxErr(data, i, "in numeric literal")
+	}
+	if i < len(data) && data[i] == '.' {
+		start := i + 1
+		if i = scanDigits(data, start); i == start {
+			return i, scanSyntaxErr(data, i, "after decimal point in numeric literal")
+		}
+	}
+	if i < len(data) && (data[i] == 'e' || data[i] == 'E') {
+		i++
+		if i < len(data) && (data[i] == '+' || data[i] == '-') {
+			i++
+		}
+		start := i
+		if i = scanDigits(data, start); i == start {
+			return i, scanSyntaxErr(data, i, "in exponent of numeric literal")
+		}
+	}
+	return i, nil
+}
+
+// scanArray returns the end offset of the JSON array that starts at data[i].
+// If fn is not nil, it is called with the offsets of each element, and scanning stops early if it returns false.
+func scanArray(data []byte, i int, depth int, fn func(start, end int) bool) (int, error) {
+	i = scanSpace(data, i+1)
+	if i < len(data) && data[i] == ']' {
+		return i + 1, nil
+	}
+	for {
+		start := i
+		end, err := scanValueDepth(data, start, depth)
+		if err != nil {
+			return end, err
+		}
+		if fn != nil && !fn(start, end) {
+			return end, nil
+		}
+		i = scanSpace(data, end)
+		if i >= len(data) {
+			return i, errUnexpectedEnd
+		}
+		switch data[i] {
+		case ',':
+			i = scanSpace(data, i+1)
+		case ']':
+			return i + 1, nil
+		default:
+			return i, scanSyntaxErr(data, i, "after array element")
+		}
+	}
+}
+
+// scanObject returns the end offset of the JSON object that starts at data[i].
+// If fn is not nil, it is called with the offsets of each key (including quotes) and value,
+// and scanning stops early if it returns false.
+func scanObject(data []byte, i int, depth int, fn func(keyStart, keyEnd, start, end int) bool) (int, error) {
+	i = scanSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return i + 1, nil
+	}
+	for {
+		if i >= len(data) {
+			return i, errUnexpectedEnd
+		}
+		if data[i] != '"' {
+			return i, scanSyntaxErr(data, i, "looking for beginning of object key string")
+		}
+		keyStart := i
+		keyEnd, err := scanString(data, keyStart)
+		if err != nil {
+			return keyEnd, err
+		}
+		i = scanSpace(data, keyEnd)
+		if i >= len(data) || data[i] != ':' {
+			return i, scanSyntaxErr(data, i, "after object key")
+		}
+		start := scanSpace(data, i+1)
+		end, err := scanValueDepth(data, start, depth)
+		if err != nil {
+			return end, err
+		}
+		if fn != nil && !fn(keyStart, keyEnd, start, end) {
+			return end, nil
+		}
+		i = scanSpace(data, end)
+		if i >= len(data) {
+			return i, errUnexpectedEnd
+		}
+		switch data[i] {
+		case ',':
+			i = scanSpace(data, i+1)
+		case '}':
+			return i + 1, nil
+		default:
+			return i, scanSyntaxErr(data, i, "after object key:value pair")
+		}
+	}
+}
+
+// stringEquals checks if the JSON string (including quotes) equals the name, without allocating.
+// The JSON string must be valid, as checked by scanString.
+func stringEquals(key []byte, name string) bool {
+	raw := key[1 : len(key)-1]
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw) == name
+	}
+	var buf [utf8.UTFMax]byte
+	for i := 0; i < len(raw); {
+		if raw[i] != '\\' {
+			if len(name) == 0 || name[0] != raw[i] {
+				return false
+			}
+			name = name[1:]
+			i++
+			continue
+		}
+		var r rune
+		switch raw[i+1] {
+		case 'b':
+			r = '\b'
+		case 'f':
+			r = '\f'
+		case 'n':
+			r = '\n'
+		case 'r':
+			r = '\r'
+		case 't':
+			r = '\t'
+		case 'u':
+			r, i = unescapeRune(raw, i)
+			n := utf8.EncodeRune(buf[:], r)
+			if !strings.HasPrefix(name, string(buf[:n])) {
+				return false
+			}
+			name = name[n:]
+			continue
+		default: // quote, backslash, slash
+			r = rune(raw[i+1])
+		}
+		if len(name) == 0 || rune(name[0]) != r {
+			return false
+		}
+		name = name[1:]
+		i += 2
+	}
+	return len(name) == 0
+}
+
+// unescapeRune decodes the \uXXXX escape sequence at raw[i], including a surrogate pair,
+// and returns the rune and the offset after the escape sequence.
+// Invalid surrogates are decoded as replacement character, like encoding/json does.
+func unescapeRune(raw []byte, i int) (rune, int) {
+	r := hexRune(raw[i+2 : i+6])
+	i += 6
+	if utf16.IsSurrogate(r) {
+		if i+6 <= len(raw) && raw[i] == '\\' && raw[i+1] == 'u' {
+			if r2 := utf16.DecodeRune(r, hexRune(raw[i+2:i+6])); r2 != utf8.RuneError {
+				return r2, i + 6
+			}
+		}
+		return utf8.RuneError, i
+	}
+	return r, i
+}
+
+func hexRune(h []byte) rune {
+	var r rune
+	for _, c := range h {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		default:
+			c = c - 'A' + 10
+		}
+		r = r<<4 | rune(c)
+	}
+	return r
+}
+
+// unquoteString returns the JSON string (including quotes) as Go string.
+func unquoteString(key []byte) string {
+	raw := key[1 : len(key)-1]
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw)
+	}
+	var s string
+	if err := json.Unmarshal(key, &s); err != nil {
+		return string(raw)
+	}
+	return s
+}
+
+func trimSpace(data []byte) []byte {
+	for len(data) > 0 && isSpace(data[0]) {
+		data = data[1:]
+	}
+	for len(data) > 0 && isSpace(data[len(data)-1]) {
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
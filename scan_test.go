@@ -0,0 +1,54 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var scanCorpus = []string{
+	`null`, `true`, `false`, `0`, `-0`, `1.5`, `-1.5e10`, `1E+2`, `""`, `"a\"b"`, `"é"`, `[]`, `{}`,
+	`[1, 2, [3, {"a": "b"}]]`, `{"a": {"b": [null, true]}, "c": 1}`, ` [ 1 , 2 ] `,
+	`nul`, `tru`, `01`, `1.`, `1e`, `-`, `.5`, `"abc`, `"\x"`, `"\u12"`, "\"\x01\"", `[1,]`, `[1 2]`,
+	`{"a" 1}`, `{"a":}`, `{a: 1}`, `{"a": 1,}`, `[`, `{`, `]`, `1 2`, ``,
+}
+
+func scanValid(data []byte) bool {
+	i := scanSpace(data, 0)
+	end, err := scanValue(data, i)
+	return err == nil && scanSpace(data, end) == len(data)
+}
+
+func TestScan(t *testing.T) {
+	for _, c := range scanCorpus {
+		if got, expected := scanValid([]byte(c)), json.Valid([]byte(c)); got != expected {
+			t.Errorf("scan of %q: got valid=%v, expected %v", c, got, expected)
+		}
+	}
+}
+
+func FuzzScan(f *testing.F) {
+	for _, c := range scanCorpus {
+		f.Add([]byte(c))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if got, expected := scanValid(data), json.Valid(data); got != expected {
+			t.Fatalf("scan of %q: got valid=%v, expected %v", data, got, expected)
+		}
+	})
+}
+
+func TestKeyEquals(t *testing.T) {
+	keys := []string{`"abc"`, `"a\"b"`, `"abc"`, `"😀"`, `"\ud83d"`, `"tab\t\/"`, `"éé"`, `"ab"`, `"\ud83d\ude00"`, `"\u00e9\u00E9"`}
+	names := []string{"abc", `a"b`, "😀", "�", "tab\t/", "éé", "ab", "abcd", ""}
+	for _, k := range keys {
+		var s string
+		if err := json.Unmarshal([]byte(k), &s); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if got, expected := stringEquals([]byte(k), name), s == name; got != expected {
+				t.Errorf("stringEquals(%s, %q): got %v, expected %v", k, name, got, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selector is a path to a value within params, evaluated directly against the params data,
+// without decoding the params. E.g. to route requests based on a block number param.
+//
+// A selector is a sequence of segments, separated by dots:
+//
+//	1            the element at index 1 of a list, or the member named "1" of a map
+//	toBlock      the member named "toBlock" of a map
+//	[1]          the element at index 1 of a list, the dot separator may be omitted before it
+//	["to.Block"] the member named "to.Block" of a map, as JSON string
+//
+// For example, "0.toBlock", "[0].toBlock" and "[0][\"toBlock\"]" all select
+// the toBlock member of the first positional param.
+type Selector struct {
+	source   string
+	segments []selectorSegment
+}
+
+type selectorSegment struct {
+	// member name, empty for bracketed indices
+	name string
+	// element index, -1 if the segment cannot be used as index
+	index int
+}
+
+// ParseSelector parses a Selector, see Selector for the syntax.
+func ParseSelector(s string) (*Selector, error) {
+	if s == "" {
+		return nil, errors.New("empty selector")
+	}
+	sel := &Selector{source: s}
+	rest := s
+	for rest != "" {
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if rest[1:] != "" && rest[1] == '"' { // the name may contain a closing bracket
+				n, err := scanString([]byte(rest), 1)
+				if err != nil || n >= len(rest) || rest[n] != ']' {
+					return nil, fmt.Errorf("invalid quoted name in selector %q", s)
+				}
+				end = n
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in selector %q", s)
+			}
+			inner := rest[1:end]
+			var seg selectorSegment
+			if inner != "" && inner[0] == '"' {
+				if err := json.Unmarshal([]byte(inner), &seg.name); err != nil {
+					return nil, fmt.Errorf("invalid quoted name in selector %q: %w", s, err)
+				}
+				seg.index = -1
+			} else {
+				i, err := parseIndex(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in selector %q: %w", s, err)
+				}
+				seg.index = i
+			}
+			sel.segments = append(sel.segments, seg)
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("empty segment in selector %q", s)
+			}
+			seg := selectorSegment{name: name, index: -1}
+			if i, err := parseIndex(name); err == nil {
+				seg.index = i
+			}
+			sel.segments = append(sel.segments, seg)
+			rest = rest[end:]
+		}
+		if rest != "" && rest[0] == '.' {
+			rest = rest[1:]
+			if rest == "" {
+				return nil, fmt.Errorf("trailing dot in selector %q", s)
+			}
+		}
+	}
+	return sel, nil
+}
+
+// MustSelector parses a Selector, and panics if it is invalid. For selectors defined as package variables.
+func MustSelector(s string) *Selector {
+	sel, err := ParseSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+func parseIndex(s string) (int, error) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("invalid index %q", s)
+	}
+	i, err := strconv.ParseUint(s, 10, 31)
+	if err != nil {
+		return 0, err
+	}
+	return int(i), nil
+}
+
+// Select returns the raw JSON value that the selector points to, as sub-slice of the params data.
+// It returns false if the value does not exist, or if the params are not valid JSON.
+func (sel *Selector) Select(p Params) (json.RawMessage, bool) {
+	if !p.valid() {
+		return nil, false
+	}
+	v := json.RawMessage(p)
+	for _, seg := range sel.segments {
+		i := scanSpace(v, 0)
+		if i >= len(v) {
+			return nil, false
+		}
+		var ok bool
+		switch {
+		case v[i] == '[' && seg.index >= 0:
+			v, ok = rawIndex(v, seg.index)
+		case v[i] == '{' && seg.name != "":
+			v, ok = rawField(v, seg.name)
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func (sel *Selector) String() string {
+	return sel.source
+}
+
+// Lookup returns the raw JSON value at the given selector path, see Selector for the syntax.
+// It returns false if the path is invalid, or if the value does not exist.
+// Parse the selector once with ParseSelector instead, to look up the same path repeatedly.
+func (p Params) Lookup(path string) (json.RawMessage, bool) {
+	sel, err := ParseSelector(path)
+	if err != nil {
+		return nil, false
+	}
+	return sel.Select(p)
+}
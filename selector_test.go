@@ -0,0 +1,72 @@
+package jsonrpc
+
+import "testing"
+
+func TestSelector(t *testing.T) {
+	p := Params(`[{"toBlock": "0x10", "address": ["0xaa", "0xbb"], "a.b": 1, "0": "zero"}, "0x1"]`)
+	cases := []struct {
+		sel      string
+		expected string
+	}{
+		{"0.toBlock", `"0x10"`},
+		{"[0].toBlock", `"0x10"`},
+		{`[0]["toBlock"]`, `"0x10"`},
+		{"[1]", `"0x1"`},
+		{"1", `"0x1"`},
+		{"0.address[1]", `"0xbb"`},
+		{"0.address.0", `"0xaa"`},
+		{`0["a.b"]`, `1`},
+		{"0.0", `"zero"`},
+		{"0", `{"toBlock": "0x10", "address": ["0xaa", "0xbb"], "a.b": 1, "0": "zero"}`},
+		{"2", ""},
+		{"0.fromBlock", ""},
+		{"1.toBlock", ""},
+		{"toBlock", ""},
+		{"0.address[2]", ""},
+		{"0[0]", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.sel, func(t *testing.T) {
+			got, ok := p.Lookup(c.sel)
+			if c.expected == "" {
+				if ok {
+					t.Fatalf("expected no value, got %s", got)
+				}
+				return
+			}
+			if !ok || string(got) != c.expected {
+				t.Fatalf("expected %s, got %s (ok: %v)", c.expected, got, ok)
+			}
+		})
+	}
+	t.Run("named params", func(t *testing.T) {
+		got, ok := Params(`{"filter": {"toBlock": "latest"}}`).Lookup("filter.toBlock")
+		if !ok || string(got) != `"latest"` {
+			t.Fatalf("unexpected value: %s", got)
+		}
+	})
+	t.Run("invalid params", func(t *testing.T) {
+		// values before the point of truncation or corruption are not returned either
+		for _, p := range []string{`[{"toBlock": "0x10"}, "0x1"`, `[{"toBlock": "0x10"}, x]`, `[{"toBlock": "0x10"}] x`} {
+			if got, ok := Params(p).Lookup("0.toBlock"); ok {
+				t.Errorf("expected no value from invalid params %s, got %s", p, got)
+			}
+		}
+	})
+	t.Run("invalid selectors", func(t *testing.T) {
+		for _, s := range []string{"", ".", "a.", "a..b", "[", "[x]", "[01]", "[-1]", `["a]`, `[""`, "a.[0"} {
+			if _, err := ParseSelector(s); err == nil {
+				t.Errorf("expected error for selector %q", s)
+			}
+		}
+	})
+	t.Run("no allocations", func(t *testing.T) {
+		sel := MustSelector("0.address[1]")
+		allocs := testing.AllocsPerRun(100, func() {
+			sel.Select(p)
+		})
+		if allocs != 0 {
+			t.Fatalf("expected no allocations, got %f", allocs)
+		}
+	})
+}
@@ -0,0 +1,276 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Handler handles a request message, and returns the response message,
+// e.g. with req.Respond or req.RespondErr. The response of a notification is discarded.
+type Handler interface {
+	ServeRPC(ctx context.Context, req *Message) *Message
+}
+
+// HandlerFunc is a function that implements Handler.
+type HandlerFunc func(ctx context.Context, req *Message) *Message
+
+func (f HandlerFunc) ServeRPC(ctx context.Context, req *Message) *Message {
+	return f(ctx, req)
+}
+
+// ServeOption configures Serve.
+type ServeOption func(cfg *serveConfig)
+
+type serveConfig struct {
+	workers         int
+	timeout         time.Duration
+	completionOrder bool
+	messageOptions  []MessageOption
+}
+
+// BatchWorkers sets the maximum number of batch elements that are handled concurrently.
+// By default, batch elements are handled sequentially.
+func BatchWorkers(n int) ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.workers = n
+	}
+}
+
+// BatchTimeout sets the deadline for handling the payload, as a whole.
+// Requests that are not finished when the deadline hits get a RequestTimeout error response,
+// and Serve returns without waiting for their handlers; the handler context is cancelled.
+func BatchTimeout(d time.Duration) ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.timeout = d
+	}
+}
+
+// CompletionOrder orders the batch responses by completion, instead of by request order.
+// Responses to unfinished requests are last.
+func CompletionOrder() ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.completionOrder = true
+	}
+}
+
+// DecodeOptions configures how each message of the payload is decoded, e.g. with StrictJSON.
+func DecodeOptions(opts ...MessageOption) ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.messageOptions = append(cfg.messageOptions, opts...)
+	}
+}
+
+// Serve handles a JSON-RPC payload, a single request or a batch of requests, and returns the encoded response payload.
+// It returns nil if there is nothing to respond with, i.e. if the payload only contains notifications.
+//
+// Invalid JSON results in a single ParseErr response with null ID, an empty batch in a single InvalidRequest response,
+// and each invalid message, including responses, in an InvalidRequest response.
+// Responses to invalid messages have the ID of the message if it can be recovered, and a null ID otherwise.
+// Batch responses are in the order of the requests, unless the CompletionOrder option is used.
+func Serve(ctx context.Context, payload []byte, h Handler, opts ...ServeOption) []byte {
+	cfg := serveConfig{workers: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	i := scanSpace(payload, 0)
+	end, err := scanValue(payload, i)
+	if err == nil && scanSpace(payload, end) != len(payload) {
+		err = scanSyntaxErr(payload, scanSpace(payload, end), "after top-level value")
+	}
+	if err != nil {
+		return encodeResponse(errorResponse("null", &MessageError{Code: ParseErr, Err: err}))
+	}
+	if payload[i] != '[' {
+		resps := cfg.serveAll(ctx, [][]byte{payload[i:end]}, h)
+		if resps[0] == nil {
+			return nil
+		}
+		return encodeResponse(resps[0])
+	}
+	var elems [][]byte
+	_, _ = scanArray(payload, i, 1, func(start, end int) bool {
+		elems = append(elems, payload[start:end])
+		return true
+	})
+	if len(elems) == 0 {
+		return encodeResponse(errorResponse("null", invalidRequest(errors.New("empty batch"))))
+	}
+	out := []byte{'['}
+	for _, resp := range cfg.serveAll(ctx, elems, h) {
+		if resp == nil {
+			continue
+		}
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		out = append(out, encodeResponse(resp)...)
+	}
+	if len(out) == 1 {
+		return nil
+	}
+	return append(out, ']')
+}
+
+// serveAll handles the messages of valid JSON, and returns the responses, nil for notifications.
+// The responses are in request order, or in completion order if configured.
+func (cfg *serveConfig) serveAll(ctx context.Context, elems [][]byte, h Handler) []*Message {
+	resps := make([]*Message, len(elems))
+	if cfg.workers <= 1 && cfg.timeout <= 0 {
+		for i, elem := range elems {
+			resps[i] = cfg.serveMessage(ctx, elem, h)
+		}
+		return resps
+	}
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+	// handlers may still run after the context is done, so they must not share the payload with the caller
+	for i := range elems {
+		elems[i] = bytes.Clone(elems[i])
+	}
+	type result struct {
+		index int
+		resp  *Message
+	}
+	results := make(chan result, len(elems))
+	workers := make(chan struct{}, max(cfg.workers, 1))
+	go func() {
+		for i, elem := range elems {
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				defer func() { <-workers }()
+				results <- result{index: i, resp: cfg.serveMessage(ctx, elem, h)}
+			}()
+		}
+	}()
+	done := make([]bool, len(elems))
+	var completed []*Message
+collect:
+	for range elems {
+		select {
+		case r := <-results:
+			done[r.index] = true
+			resps[r.index] = r.resp
+			if r.resp != nil {
+				completed = append(completed, r.resp)
+			}
+		case <-ctx.Done():
+			break collect
+		}
+	}
+	for i, elem := range elems {
+		if done[i] {
+			continue
+		}
+		resps[i] = cfg.timeoutResponse(elem, ctx.Err())
+		if resps[i] != nil {
+			completed = append(completed, resps[i])
+		}
+	}
+	if cfg.completionOrder {
+		return completed
+	}
+	return resps
+}
+
+// serveMessage handles a single message of valid JSON, and returns the response, or nil for notifications.
+func (cfg *serveConfig) serveMessage(ctx context.Context, data []byte, h Handler) *Message {
+	req, errResp := cfg.decodeRequest(data)
+	if errResp != nil {
+		return errResp
+	}
+	resp := callHandler(ctx, h, req)
+	if req.ID.IsNotification() {
+		return nil
+	}
+	return resp
+}
+
+// decodeRequest decodes the request message of valid JSON, or returns an InvalidRequest response.
+func (cfg *serveConfig) decodeRequest(data []byte) (req *Message, errResp *Message) {
+	req, err := DecodeMessage(data, cfg.messageOptions...)
+	if err == nil && req.Request == nil {
+		err = invalidRequest(errors.New("expected a request, got a response"))
+	}
+	if err != nil {
+		return nil, errorResponse(recoverID(data), err)
+	}
+	return req, nil
+}
+
+// timeoutResponse responds to the message of valid JSON that was not handled in time, nil for notifications.
+func (cfg *serveConfig) timeoutResponse(data []byte, err error) *Message {
+	req, errResp := cfg.decodeRequest(data)
+	if errResp != nil {
+		return errResp
+	}
+	if req.ID.IsNotification() {
+		return nil
+	}
+	return errorResponse(req.ID, AnnotatedErrorObj(RequestTimeout, err))
+}
+
+// callHandler calls the handler, and turns panics and invalid responses into InternalError responses.
+func callHandler(ctx context.Context, h Handler, req *Message) (resp *Message) {
+	defer func() {
+		if x := recover(); x != nil {
+			resp = errorResponse(req.ID, fmt.Errorf("handler panic: %v", x))
+		}
+	}()
+	out := h.ServeRPC(ctx, req)
+	if out == nil || out.Response == nil || out.Request != nil {
+		return errorResponse(req.ID, errors.New("handler did not return a response"))
+	}
+	cp := *out
+	cp.ID = req.ID
+	return &cp
+}
+
+// recoverID returns the ID of the message of valid JSON, or a null ID if it has no valid ID.
+func recoverID(data []byte) RawID {
+	id := RawID("null")
+	if len(data) == 0 || data[0] != '{' {
+		return id
+	}
+	_, _ = scanObject(data, 0, 1, func(keyStart, keyEnd, start, end int) bool {
+		if messageMember(data[keyStart:keyEnd]) == memberID {
+			if v := data[start:end]; validRawID(v) {
+				id = RawID(v)
+			} else {
+				id = "null"
+			}
+		}
+		return true
+	})
+	return id
+}
+
+func errorResponse(id RawID, err error) *Message {
+	return &Message{
+		Request: nil,
+		Response: &Response{
+			Result: nil,
+			Error:  AsErrorObj(err),
+		},
+		ID: id,
+	}
+}
+
+// encodeResponse encodes the response, or an InternalError response if it cannot be encoded.
+func encodeResponse(resp *Message) []byte {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(errorResponse(resp.ID, fmt.Errorf("failed to encode response: %w", err)))
+	}
+	return data
+}
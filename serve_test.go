@@ -0,0 +1,350 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// specHandler implements the methods of the examples in the JSON-RPC 2.0 specification.
+var specHandler = HandlerFunc(func(ctx context.Context, req *Message) *Message {
+	switch req.Method {
+	case "subtract":
+		type subtractParams struct {
+			Minuend    int `json:"minuend"`
+			Subtrahend int `json:"subtrahend"`
+		}
+		args, err := ParamsDecoder[subtractParams]()(req.Params)
+		if err != nil {
+			return req.RespondErr(AsErrorObj(err))
+		}
+		return req.Respond(args.Minuend - args.Subtrahend)
+	case "sum":
+		args, err := ParamsDecoder[[]int]()(req.Params)
+		if err != nil {
+			return req.RespondErr(AsErrorObj(err))
+		}
+		sum := 0
+		for _, x := range args {
+			sum += x
+		}
+		return req.Respond(sum)
+	case "get_data":
+		return req.Respond([]any{"hello", 5})
+	case "update", "notify_hello", "notify_sum", "foobar":
+		if req.ID.IsNotification() {
+			return req.Respond(nil)
+		}
+		return req.RespondErr(ConstErrorObj(MethodNotFound))
+	case "panic":
+		panic("boom")
+	case "nothing":
+		return nil
+	default:
+		return req.RespondErr(ConstErrorObj(MethodNotFound))
+	}
+})
+
+// checkServeOutput compares the responses by ID, result and error code, ignoring error messages.
+func checkServeOutput(t *testing.T, out []byte, expected string) {
+	t.Helper()
+	if expected == "" {
+		if out != nil {
+			t.Fatalf("expected no output, got %s", out)
+		}
+		return
+	}
+	normalize := func(data []byte) any {
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			t.Fatalf("invalid JSON %s: %v", data, err)
+		}
+		var strip func(v any)
+		strip = func(v any) {
+			switch x := v.(type) {
+			case []any:
+				for _, item := range x {
+					strip(item)
+				}
+			case map[string]any:
+				if e, ok := x["error"].(map[string]any); ok {
+					delete(e, "message")
+					delete(e, "data")
+				}
+			}
+		}
+		strip(v)
+		return v
+	}
+	if got, want := normalize(out), normalize([]byte(expected)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected output:\ngot:      %s\nexpected: %s", out, expected)
+	}
+}
+
+func TestServeSpec(t *testing.T) {
+	// examples from section 7 of the JSON-RPC 2.0 specification
+	for _, tc := range []struct {
+		name     string
+		payload  string
+		expected string
+	}{
+		{"positional parameters",
+			`{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}`,
+			`{"jsonrpc": "2.0", "result": 19, "id": 1}`},
+		{"positional parameters reversed",
+			`{"jsonrpc": "2.0", "method": "subtract", "params": [23, 42], "id": 2}`,
+			`{"jsonrpc": "2.0", "result": -19, "id": 2}`},
+		{"named parameters",
+			`{"jsonrpc": "2.0", "method": "subtract", "params": {"subtrahend": 23, "minuend": 42}, "id": 3}`,
+			`{"jsonrpc": "2.0", "result": 19, "id": 3}`},
+		{"named parameters reordered",
+			`{"jsonrpc": "2.0", "method": "subtract", "params": {"minuend": 42, "subtrahend": 23}, "id": 4}`,
+			`{"jsonrpc": "2.0", "result": 19, "id": 4}`},
+		{"notification",
+			`{"jsonrpc": "2.0", "method": "update", "params": [1,2,3,4,5]}`,
+			``},
+		{"notification without params",
+			`{"jsonrpc": "2.0", "method": "foobar"}`,
+			``},
+		{"non-existent method",
+			`{"jsonrpc": "2.0", "method": "foobar", "id": "1"}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "1"}`},
+		{"invalid JSON",
+			`{"jsonrpc": "2.0", "method": "foobar, "params": "bar", "baz]`,
+			`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`},
+		{"invalid request object",
+			`{"jsonrpc": "2.0", "method": 1, "params": "bar"}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`},
+		{"batch invalid JSON",
+			`[
+  {"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+  {"jsonrpc": "2.0", "method"
+]`,
+			`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`},
+		{"empty batch",
+			`[]`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`},
+		{"invalid batch",
+			`[1]`,
+			`[{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}]`},
+		{"invalid batch elements",
+			`[1,2,3]`,
+			`[
+  {"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null},
+  {"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null},
+  {"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}
+]`},
+		{"batch",
+			`[
+  {"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+  {"jsonrpc": "2.0", "method": "notify_hello", "params": [7]},
+  {"jsonrpc": "2.0", "method": "subtract", "params": [42,23], "id": "2"},
+  {"foo": "boo"},
+  {"jsonrpc": "2.0", "method": "foo.get", "params": {"name": "myself"}, "id": "5"},
+  {"jsonrpc": "2.0", "method": "get_data", "id": "9"}
+]`,
+			`[
+  {"jsonrpc": "2.0", "result": 7, "id": "1"},
+  {"jsonrpc": "2.0", "result": 19, "id": "2"},
+  {"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null},
+  {"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "5"},
+  {"jsonrpc": "2.0", "result": ["hello", 5], "id": "9"}
+]`},
+		{"batch of notifications",
+			`[
+  {"jsonrpc": "2.0", "method": "notify_sum", "params": [1,2,4]},
+  {"jsonrpc": "2.0", "method": "notify_hello", "params": [7]}
+]`,
+			``},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			checkServeOutput(t, Serve(context.Background(), []byte(tc.payload), specHandler), tc.expected)
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		payload  string
+		expected string
+	}{
+		{"recovered ID of invalid request",
+			`{"jsonrpc": "2.0", "method": 1, "id": 7}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600}, "id": 7}`},
+		{"recovered ID of invalid version",
+			`{"jsonrpc": "1.0", "method": "sum", "params": [1], "id": "a"}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600}, "id": "a"}`},
+		{"invalid ID",
+			`{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1.5}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}`},
+		{"invalid notification",
+			`{"jsonrpc": "2.0", "method": "sum", "params": "x"}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}`},
+		{"response",
+			`{"jsonrpc": "2.0", "result": 1, "id": 3}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600}, "id": 3}`},
+		{"null ID",
+			`{"jsonrpc": "2.0", "method": "sum", "params": [1, 2], "id": null}`,
+			`{"jsonrpc": "2.0", "result": 3, "id": null}`},
+		{"invalid params",
+			`{"jsonrpc": "2.0", "method": "sum", "params": ["x"], "id": 1}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32602}, "id": 1}`},
+		{"handler panic",
+			`{"jsonrpc": "2.0", "method": "panic", "id": 1}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32603}, "id": 1}`},
+		{"handler panic in notification",
+			`{"jsonrpc": "2.0", "method": "panic"}`,
+			``},
+		{"handler without response",
+			`[{"jsonrpc": "2.0", "method": "nothing", "id": 1}]`,
+			`[{"jsonrpc": "2.0", "error": {"code": -32603}, "id": 1}]`},
+		{"trailing data",
+			`{"jsonrpc": "2.0", "method": "sum", "params": [1], "id": 1} {}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32700}, "id": null}`},
+		{"empty payload",
+			``,
+			`{"jsonrpc": "2.0", "error": {"code": -32700}, "id": null}`},
+		{"whitespace",
+			" \n[ {\"jsonrpc\": \"2.0\", \"method\": \"sum\", \"params\": [1], \"id\": 1} ]\n",
+			`[{"jsonrpc": "2.0", "result": 1, "id": 1}]`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			checkServeOutput(t, Serve(context.Background(), []byte(tc.payload), specHandler), tc.expected)
+		})
+	}
+}
+
+func TestAsErrorObj(t *testing.T) {
+	if obj := AsErrorObj(MethodNotFound); obj.Code != -32601 || obj.Message != "Method not found" {
+		t.Fatalf("unexpected error object: %+v", obj)
+	}
+	if obj := AsErrorObj(&ParamsError{Reason: "bad"}); obj.Code != -32602 {
+		t.Fatalf("unexpected error object: %+v", obj)
+	}
+	custom := &ErrorObject{Code: 3, Message: "execution reverted", Data: json.RawMessage(`"0x"`)}
+	if obj := AsErrorObj(fmt.Errorf("call failed: %w", custom)); obj != custom {
+		t.Fatalf("unexpected error object: %+v", obj)
+	}
+	if obj := AsErrorObj(errors.New("oops")); obj.Code != -32603 || obj.Message != "Internal error: oops" {
+		t.Fatalf("unexpected error object: %+v", obj)
+	}
+}
+
+func TestServeConcurrent(t *testing.T) {
+	// sleep sleeps for the number of milliseconds in the first param, or until the context is done
+	sleep := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		ms, err := ParamsDecoder[struct{ Ms int }]()(req.Params)
+		if err != nil {
+			return req.RespondErr(AsErrorObj(err))
+		}
+		select {
+		case <-time.After(time.Duration(ms.Ms) * time.Millisecond):
+			return req.Respond(ms.Ms)
+		case <-ctx.Done():
+			return req.RespondErr(AsErrorObj(ctx.Err()))
+		}
+	})
+	batch := func(ms ...int) []byte {
+		var msgs []*Message
+		for i, x := range ms {
+			m, err := NewRequest(RawID(strconv.Itoa(i)), "sleep", struct{ Ms int }{x})
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs = append(msgs, m)
+		}
+		data, err := json.Marshal(msgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	ids := func(out []byte) (ids []string, timeouts int) {
+		var resps []*Message
+		if err := json.Unmarshal(out, &resps); err != nil {
+			t.Fatalf("invalid output %s: %v", out, err)
+		}
+		for _, resp := range resps {
+			ids = append(ids, string(resp.ID))
+			if resp.IsError() {
+				timeouts++
+			}
+		}
+		return ids, timeouts
+	}
+	t.Run("worker limit", func(t *testing.T) {
+		var active, peak atomic.Int32
+		h := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			return sleep(ctx, req)
+		})
+		out := Serve(context.Background(), batch(10, 10, 10, 10, 10, 10, 10, 10), h, BatchWorkers(3))
+		got, timeouts := ids(out)
+		if !reflect.DeepEqual(got, []string{"0", "1", "2", "3", "4", "5", "6", "7"}) || timeouts != 0 {
+			t.Fatalf("unexpected responses: %s", out)
+		}
+		if p := peak.Load(); p > 3 || p < 2 {
+			t.Fatalf("unexpected peak concurrency: %d", p)
+		}
+	})
+	t.Run("completion order", func(t *testing.T) {
+		out := Serve(context.Background(), batch(150, 1, 75), sleep, BatchWorkers(3), CompletionOrder())
+		if got, _ := ids(out); !reflect.DeepEqual(got, []string{"1", "2", "0"}) {
+			t.Fatalf("unexpected response order: %s", out)
+		}
+	})
+	t.Run("request order", func(t *testing.T) {
+		out := Serve(context.Background(), batch(150, 1, 75), sleep, BatchWorkers(3))
+		if got, _ := ids(out); !reflect.DeepEqual(got, []string{"0", "1", "2"}) {
+			t.Fatalf("unexpected response order: %s", out)
+		}
+	})
+	t.Run("deadline", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		block := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			if req.Method == "block" {
+				<-release // ignores the context, Serve must not wait for it
+				return req.Respond(nil)
+			}
+			return sleep(ctx, req)
+		})
+		payload := []byte(`[
+			{"jsonrpc": "2.0", "id": 0, "method": "sleep", "params": [1]},
+			{"jsonrpc": "2.0", "id": 1, "method": "block"},
+			{"jsonrpc": "2.0", "method": "block"},
+			{"jsonrpc": "2.0", "id": 2, "method": "sleep", "params": [1]},
+			{"jsonrpc": "2.0", "id": 3, "method": 1}
+		]`)
+		start := time.Now()
+		out := Serve(context.Background(), payload, block, BatchWorkers(3), BatchTimeout(100*time.Millisecond))
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("deadline not enforced, took %s", d)
+		}
+		checkServeOutput(t, out, `[
+			{"jsonrpc": "2.0", "result": 1, "id": 0},
+			{"jsonrpc": "2.0", "error": {"code": -32098}, "id": 1},
+			{"jsonrpc": "2.0", "result": 1, "id": 2},
+			{"jsonrpc": "2.0", "error": {"code": -32600}, "id": 3}
+		]`)
+	})
+	t.Run("single request deadline", func(t *testing.T) {
+		out := Serve(context.Background(), []byte(`{"jsonrpc": "2.0", "id": 1, "method": "sleep", "params": [10000]}`),
+			sleep, BatchTimeout(10*time.Millisecond))
+		checkServeOutput(t, out, `{"jsonrpc": "2.0", "error": {"code": -32098}, "id": 1}`)
+	})
+}
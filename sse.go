@@ -0,0 +1,473 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionHeader is the HTTP header that identifies the session of requests to session-based HTTP transports, such as SSEHandler.
+// The session can also be passed as "session" query parameter, e.g. by browsers with EventSource.
+const SessionHeader = "X-JSONRPC-Session"
+
+const (
+	// DefaultSSEHeartbeatInterval is how often an event stream gets a heartbeat comment by default.
+	DefaultSSEHeartbeatInterval = 15 * time.Second
+	// DefaultSSEReplayBuffer is how many events a session keeps for replay by default.
+	DefaultSSEReplayBuffer = 256
+	// DefaultSSESessionTimeout is how long a session is kept without event stream by default.
+	DefaultSSESessionTimeout = 5 * time.Minute
+)
+
+// SSEOption configures NewSSEHandler.
+type SSEOption func(cfg *sseConfig)
+
+type sseConfig struct {
+	heartbeat      time.Duration
+	replayBuffer   int
+	sessionTimeout time.Duration
+	maxBodySize    int64
+	serveOptions   []ServeOption
+}
+
+// SSEHeartbeatInterval sets how often a heartbeat comment is sent on the event stream,
+// to keep proxies from closing it, DefaultSSEHeartbeatInterval by default. Zero disables heartbeats.
+func SSEHeartbeatInterval(d time.Duration) SSEOption {
+	return func(cfg *sseConfig) {
+		cfg.heartbeat = d
+	}
+}
+
+// SSEReplayBuffer sets how many of the last events a session keeps,
+// to replay them to a client that reconnects with Last-Event-ID, DefaultSSEReplayBuffer by default.
+// Events are buffered while no stream is connected, so at least one event is kept.
+func SSEReplayBuffer(n int) SSEOption {
+	return func(cfg *sseConfig) {
+		cfg.replayBuffer = n
+	}
+}
+
+// SSESessionTimeout sets how long a session is kept while no event stream is connected,
+// DefaultSSESessionTimeout by default. Handlers of an expired session are cancelled.
+func SSESessionTimeout(d time.Duration) SSEOption {
+	return func(cfg *sseConfig) {
+		cfg.sessionTimeout = d
+	}
+}
+
+// SSEMaxBodySize limits the size of POST request bodies, DefaultMaxBodySize by default.
+func SSEMaxBodySize(n int64) SSEOption {
+	return func(cfg *sseConfig) {
+		cfg.maxBodySize = n
+	}
+}
+
+// SSEServeOptions configures how the payload of each POST request is served, see Serve.
+func SSEServeOptions(opts ...ServeOption) SSEOption {
+	return func(cfg *sseConfig) {
+		cfg.serveOptions = append(cfg.serveOptions, opts...)
+	}
+}
+
+// SSEHandler serves JSON-RPC over HTTP with Server-Sent Events, for clients that cannot use websockets.
+//
+// A client opens a session with a GET request that accepts text/event-stream.
+// The first event of a new session is a "session" event, with the session ID as data.
+// Requests are sent by POST, with the session ID in the SessionHeader header or "session" query parameter,
+// and are accepted with status 202. Their responses, and notifications of handlers, e.g. for subscriptions,
+// are sent as "message" events on the stream, with the JSON-RPC payload as data.
+//
+// Event IDs include the session ID, so a client that reconnects with Last-Event-ID resumes its session,
+// and receives the events it missed, if they are still buffered.
+// A DELETE request with the session ID ends the session.
+type SSEHandler struct {
+	handler Handler
+	cfg     sseConfig
+
+	mu       sync.Mutex
+	sessions map[string]*sseSession
+	closed   bool
+	handlers sync.WaitGroup
+}
+
+var _ http.Handler = (*SSEHandler)(nil)
+
+// NewSSEHandler creates an http.Handler that serves the JSON-RPC handler with Server-Sent Events.
+// Handlers find the Notifier of the session in the request context.
+func NewSSEHandler(h Handler, opts ...SSEOption) *SSEHandler {
+	cfg := sseConfig{
+		heartbeat:      DefaultSSEHeartbeatInterval,
+		replayBuffer:   DefaultSSEReplayBuffer,
+		sessionTimeout: DefaultSSESessionTimeout,
+		maxBodySize:    DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.replayBuffer = max(cfg.replayBuffer, 1)
+	return &SSEHandler{handler: h, cfg: cfg, sessions: make(map[string]*sseSession)}
+}
+
+func (s *SSEHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.serveStream(w, r)
+	case http.MethodPost:
+		s.servePost(w, r)
+	case http.MethodDelete:
+		session, ok := s.requestSession(w, r)
+		if !ok {
+			return
+		}
+		session.close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Close ends all sessions, and waits for their handlers to return.
+func (s *SSEHandler) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	sessions := make([]*sseSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+	for _, session := range sessions {
+		session.close()
+	}
+	s.handlers.Wait()
+	return nil
+}
+
+// requestSession returns the session of the request, or responds with an error and returns false.
+func (s *SSEHandler) requestSession(w http.ResponseWriter, r *http.Request) (*sseSession, bool) {
+	id := requestSessionID(r)
+	if id == "" {
+		http.Error(w, "missing session", http.StatusBadRequest)
+		return nil, false
+	}
+	if session := s.session(id); session != nil {
+		return session, true
+	}
+	http.Error(w, "unknown session", http.StatusNotFound)
+	return nil, false
+}
+
+func (s *SSEHandler) session(id string) *sseSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[id]
+}
+
+func (s *SSEHandler) servePost(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.requestSession(w, r)
+	if !ok {
+		return
+	}
+	if !isJSONContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "unsupported content type, JSON-RPC requires application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, ok := readBody(w, r, s.cfg.maxBodySize)
+	if !ok {
+		return
+	}
+	// the response is sent on the event stream, so the handler outlives the POST request
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		http.Error(w, "server closed", http.StatusServiceUnavailable)
+		return
+	}
+	s.handlers.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer s.handlers.Done()
+		out := Serve(ContextWithNotifier(session.ctx, session), body, s.handler, s.cfg.serveOptions...)
+		if out != nil {
+			session.push(out)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveStream streams the events of the session, a new session, or the session of the Last-Event-ID.
+func (s *SSEHandler) serveStream(w http.ResponseWriter, r *http.Request) {
+	var session *sseSession
+	var cursor uint64
+	if requestSessionID(r) != "" {
+		var ok bool
+		if session, ok = s.requestSession(w, r); !ok {
+			return
+		}
+	}
+	if id, seq, ok := parseEventID(r.Header.Get("Last-Event-ID")); ok && (session == nil || session.id == id) {
+		if last := s.session(id); last != nil {
+			session, cursor = last, seq
+		}
+	}
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// disables response buffering of nginx
+	h.Set("X-Accel-Buffering", "no")
+	if session == nil {
+		var err error
+		if session, err = s.newSession(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	// attached before the session is announced, so it does not expire while the stream starts
+	stop := session.attach()
+	defer session.detach(stop)
+	h.Set(SessionHeader, session.id)
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	var heartbeat <-chan time.Time
+	if s.cfg.heartbeat > 0 {
+		ticker := time.NewTicker(s.cfg.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	var buf bytes.Buffer
+	for {
+		events, wake := session.since(cursor)
+		if len(events) > 0 {
+			buf.Reset()
+			for _, ev := range events {
+				writeEvent(&buf, session.id, ev)
+				cursor = ev.seq
+			}
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		select {
+		case <-wake:
+		case <-heartbeat:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		case <-session.closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *SSEHandler) newSession() (*sseSession, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &sseSession{
+		id:     id,
+		srv:    s,
+		ctx:    ctx,
+		cancel: cancel,
+		wake:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	session.expiry = time.AfterFunc(s.cfg.sessionTimeout, session.close)
+	session.pushEvent("session", []byte(session.id))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		cancel()
+		return nil, ErrPeerClosed
+	}
+	s.sessions[session.id] = session
+	return session, nil
+}
+
+// requestSessionID returns the session ID of the request, from the SessionHeader header or "session" query parameter.
+func requestSessionID(r *http.Request) string {
+	if id := r.Header.Get(SessionHeader); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("session")
+}
+
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// parseEventID parses the event ID of a session event, formatted as "<session>-<seq>".
+func parseEventID(v string) (id string, seq uint64, ok bool) {
+	i := strings.LastIndexByte(v, '-')
+	if i <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(v[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return v[:i], seq, true
+}
+
+// writeEvent encodes the event, splitting the data over multiple data lines if it has line breaks.
+func writeEvent(buf *bytes.Buffer, session string, ev sseEvent) {
+	buf.WriteString("id: ")
+	buf.WriteString(session)
+	buf.WriteByte('-')
+	buf.WriteString(strconv.FormatUint(ev.seq, 10))
+	buf.WriteString("\nevent: ")
+	buf.WriteString(ev.name)
+	buf.WriteByte('\n')
+	for _, line := range bytes.Split(ev.data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+}
+
+type sseEvent struct {
+	seq  uint64
+	name string
+	data []byte
+}
+
+// sseSession ties the POST requests and event streams of a client together.
+type sseSession struct {
+	id     string
+	srv    *SSEHandler
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	events  []sseEvent
+	lastSeq uint64
+	// closed and replaced when an event is pushed
+	wake chan struct{}
+	// closed to stop the connected stream, nil if there is none
+	stream chan struct{}
+	expiry *time.Timer
+	closed chan struct{}
+	done   bool
+}
+
+var _ Notifier = (*sseSession)(nil)
+
+// Notify sends a notification to the client, as event on the stream.
+// The event is buffered if no stream is connected, until the client reconnects.
+func (s *sseSession) Notify(ctx context.Context, method string, params any) error {
+	msg, err := NewNotification(method, params)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-s.closed:
+		return ErrPeerClosed
+	default:
+	}
+	s.push(data)
+	return nil
+}
+
+// Closed is closed when the session ends.
+func (s *sseSession) Closed() <-chan struct{} {
+	return s.closed
+}
+
+func (s *sseSession) push(data []byte) {
+	s.pushEvent("message", data)
+}
+
+func (s *sseSession) pushEvent(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSeq++
+	s.events = append(s.events, sseEvent{seq: s.lastSeq, name: name, data: data})
+	if over := len(s.events) - s.srv.cfg.replayBuffer; over > 0 {
+		s.events = append(s.events[:0], s.events[over:]...)
+	}
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// since returns the buffered events after the sequence number, and a channel that is closed on the next event.
+func (s *sseSession) since(seq uint64) ([]sseEvent, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := len(s.events)
+	for i > 0 && s.events[i-1].seq > seq {
+		i--
+	}
+	return s.events[i:len(s.events):len(s.events)], s.wake
+}
+
+// attach stops the expiry of the session, and the stream that was connected before, if any.
+func (s *sseSession) attach() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream != nil {
+		close(s.stream)
+	}
+	s.stream = make(chan struct{})
+	s.expiry.Stop()
+	return s.stream
+}
+
+// detach starts the expiry of the session, unless another stream was connected since.
+func (s *sseSession) detach(stream chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream != stream {
+		return
+	}
+	s.stream = nil
+	if !s.done {
+		s.expiry.Reset(s.srv.cfg.sessionTimeout)
+	}
+}
+
+// close ends the session, and cancels its handlers.
+func (s *sseSession) close() {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	s.expiry.Stop()
+	close(s.closed)
+	s.mu.Unlock()
+	s.cancel()
+	s.srv.mu.Lock()
+	delete(s.srv.sessions, s.id)
+	s.srv.mu.Unlock()
+}
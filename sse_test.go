@@ -0,0 +1,315 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testEvent struct {
+	id, name, data string
+	comment        bool
+}
+
+// openEventStream connects to the SSE endpoint, and returns the response and its parsed events.
+func openEventStream(t *testing.T, ctx context.Context, url string, header http.Header) (*http.Response, <-chan testEvent) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan testEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev testEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				events <- ev
+				ev = testEvent{}
+			case strings.HasPrefix(line, ":"):
+				events <- testEvent{comment: true, data: strings.TrimSpace(line[1:])}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = line[4:]
+			case strings.HasPrefix(line, "event: "):
+				ev.name = line[7:]
+			case strings.HasPrefix(line, "data: "):
+				ev.data += line[6:]
+			}
+		}
+	}()
+	return resp, events
+}
+
+func nextEvent(t *testing.T, events <-chan testEvent) testEvent {
+	t.Helper()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("event stream closed")
+			}
+			if ev.comment {
+				continue
+			}
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+	}
+}
+
+func postSSE(t *testing.T, url, session, body string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set(SessionHeader, session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func newSSEServer(t *testing.T, opts ...SSEOption) (*SSEHandler, string) {
+	t.Helper()
+	subscribe := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		if req.Method != "subscribe" {
+			return specHandler(ctx, req)
+		}
+		n, ok := NotifierFromContext(ctx)
+		if !ok {
+			return req.RespondErr(ConstErrorObj(InternalError))
+		}
+		for i := 0; i < 3; i++ {
+			if err := n.Notify(ctx, "subscription", []int{i}); err != nil {
+				return req.RespondErr(AsErrorObj(err))
+			}
+		}
+		return req.Respond("0x1")
+	})
+	h := NewSSEHandler(subscribe, opts...)
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() {
+		srv.CloseClientConnections()
+		_ = h.Close()
+		srv.Close()
+	})
+	return h, srv.URL
+}
+
+func TestSSE(t *testing.T) {
+	t.Run("call", func(t *testing.T) {
+		_, url := newSSEServer(t)
+		resp, events := openEventStream(t, context.Background(), url, nil)
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("unexpected content type: %s", ct)
+		}
+		ev := nextEvent(t, events)
+		if ev.name != "session" || ev.data != resp.Header.Get(SessionHeader) || ev.id != ev.data+"-1" {
+			t.Fatalf("unexpected session event: %+v", ev)
+		}
+		session := ev.data
+		if code := postSSE(t, url, session, `{"jsonrpc":"2.0","method":"subtract","params":[42,23],"id":1}`); code != http.StatusAccepted {
+			t.Fatalf("unexpected status: %d", code)
+		}
+		ev = nextEvent(t, events)
+		if ev.name != "message" || ev.id != session+"-2" || ev.data != `{"result":19,"id":1,"jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+		if code := postSSE(t, url, session, `{"jsonrpc":"2.0","method":"notify_hello","params":[7]}`); code != http.StatusAccepted {
+			t.Fatalf("unexpected status: %d", code)
+		}
+		if code := postSSE(t, url, session, `[{"jsonrpc":"2.0","method":"subtract","params":[5,1],"id":2}]`); code != http.StatusAccepted {
+			t.Fatalf("unexpected status: %d", code)
+		}
+		if ev = nextEvent(t, events); ev.data != `[{"result":4,"id":2,"jsonrpc":"2.0"}]` {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	})
+	t.Run("subscription", func(t *testing.T) {
+		_, url := newSSEServer(t)
+		_, events := openEventStream(t, context.Background(), url, nil)
+		session := nextEvent(t, events).data
+		postSSE(t, url, session, `{"jsonrpc":"2.0","method":"subscribe","id":"s"}`)
+		for i := 0; i < 3; i++ {
+			ev := nextEvent(t, events)
+			expected := `{"method":"subscription","params":[` + string(rune('0'+i)) + `],"jsonrpc":"2.0"}`
+			if ev.data != expected {
+				t.Fatalf("expected %s, got %s", expected, ev.data)
+			}
+		}
+		if ev := nextEvent(t, events); ev.data != `{"result":"0x1","id":"s","jsonrpc":"2.0"}` {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	})
+	t.Run("replay", func(t *testing.T) {
+		_, url := newSSEServer(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		_, events := openEventStream(t, ctx, url, nil)
+		first := nextEvent(t, events)
+		session := first.data
+		cancel()
+		for range events {
+		}
+		// responses are buffered while the client is disconnected
+		postSSE(t, url, session, `{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}`)
+		postSSE(t, url, session, `{"jsonrpc":"2.0","method":"subtract","params":[3,1],"id":2}`)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		resp, events := openEventStream(t, ctx, url, http.Header{"Last-Event-ID": {first.id}})
+		if resp.Header.Get(SessionHeader) != session {
+			t.Fatal("expected session to be resumed")
+		}
+		got := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			got[nextEvent(t, events).id] = true
+		}
+		if !got[session+"-2"] || !got[session+"-3"] {
+			t.Fatalf("unexpected replay: %v", got)
+		}
+		cancel()
+		for range events {
+		}
+
+		// reconnecting after the second event replays the third only
+		_, events = openEventStream(t, context.Background(), url+"?session="+session, http.Header{"Last-Event-ID": {session + "-2"}})
+		if ev := nextEvent(t, events); ev.id != session+"-3" {
+			t.Fatalf("expected replay of third event, got %+v", ev)
+		}
+	})
+	t.Run("heartbeat", func(t *testing.T) {
+		_, url := newSSEServer(t, SSEHeartbeatInterval(10*time.Millisecond))
+		_, events := openEventStream(t, context.Background(), url, nil)
+		nextEvent(t, events)
+		select {
+		case ev := <-events:
+			if !ev.comment || ev.data != "heartbeat" {
+				t.Fatalf("expected heartbeat, got %+v", ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no heartbeat")
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		_, url := newSSEServer(t)
+		if code := postSSE(t, url, "", `{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}`); code != http.StatusBadRequest {
+			t.Fatalf("expected bad request, got %d", code)
+		}
+		if code := postSSE(t, url, "unknown", `{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}`); code != http.StatusNotFound {
+			t.Fatalf("expected not found, got %d", code)
+		}
+		resp, _ := openEventStream(t, context.Background(), url+"?session=unknown", nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected not found, got %d", resp.StatusCode)
+		}
+		req, _ := http.NewRequest(http.MethodPut, url, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, POST, DELETE" {
+			t.Fatalf("unexpected response: %d %v", resp.StatusCode, resp.Header)
+		}
+	})
+	t.Run("expiry", func(t *testing.T) {
+		h, url := newSSEServer(t, SSESessionTimeout(20*time.Millisecond))
+		ctx, cancel := context.WithCancel(context.Background())
+		_, events := openEventStream(t, ctx, url, nil)
+		session := nextEvent(t, events).data
+		s := h.session(session)
+		cancel()
+		for range events {
+		}
+		select {
+		case <-s.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("session did not expire")
+		}
+		if code := postSSE(t, url, session, `{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}`); code != http.StatusNotFound {
+			t.Fatalf("expected expired session, got %d", code)
+		}
+		// a stream keeps the session alive
+		_, events = openEventStream(t, context.Background(), url, nil)
+		session = nextEvent(t, events).data
+		s = h.session(session)
+		select {
+		case <-s.closed:
+			t.Fatal("session expired while streaming")
+		case <-time.After(100 * time.Millisecond):
+		}
+		if code := postSSE(t, url, session, `{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}`); code != http.StatusAccepted {
+			t.Fatalf("expected session to be kept, got %d", code)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		_, url := newSSEServer(t)
+		_, events := openEventStream(t, context.Background(), url, nil)
+		session := nextEvent(t, events).data
+		req, _ := http.NewRequest(http.MethodDelete, url, nil)
+		req.Header.Set(SessionHeader, session)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("unexpected status: %d", resp.StatusCode)
+		}
+		// the stream ends with the session
+		for range events {
+		}
+		if code := postSSE(t, url, session, `{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":1}`); code != http.StatusNotFound {
+			t.Fatalf("expected ended session, got %d", code)
+		}
+	})
+	t.Run("close", func(t *testing.T) {
+		started := make(chan struct{})
+		stopped := make(chan struct{})
+		h := NewSSEHandler(HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			close(started)
+			<-ctx.Done()
+			close(stopped)
+			return req.RespondErr(AsErrorObj(ctx.Err()))
+		}))
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+		_, events := openEventStream(t, context.Background(), srv.URL, nil)
+		session := nextEvent(t, events).data
+		postSSE(t, srv.URL, session, `{"jsonrpc":"2.0","method":"block","id":1}`)
+		<-started
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-stopped:
+		default:
+			t.Fatal("handler still running after close")
+		}
+		for range events {
+		}
+	})
+}
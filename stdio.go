@@ -0,0 +1,162 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StdioConn is a Conn of payloads with Content-Length framing, as used by language servers and tool plugins
+// over the stdin and stdout of a process:
+//
+//	Content-Length: 52\r\n
+//	\r\n
+//	{"jsonrpc":"2.0","method":"initialized","params":{}}
+//
+// Other headers, such as Content-Type, are ignored when reading.
+type StdioConn struct {
+	r         *bufio.Reader
+	rc        io.Closer
+	w         io.WriteCloser
+	readLimit int64
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ Conn = (*StdioConn)(nil)
+
+// NewStdioConn frames payloads read from r and written to w, e.g. os.Stdin and os.Stdout,
+// or the stdout and stdin pipes of a subprocess.
+// Payloads larger than the read limit fail to read, or payloads larger than DefaultMaxBodySize if the limit is 0.
+func NewStdioConn(r io.ReadCloser, w io.WriteCloser, readLimit int64) *StdioConn {
+	if readLimit <= 0 {
+		readLimit = DefaultMaxBodySize
+	}
+	return &StdioConn{
+		r:         bufio.NewReader(r),
+		rc:        r,
+		w:         w,
+		readLimit: readLimit,
+	}
+}
+
+// maxHeaderLine limits the length of a header line.
+const maxHeaderLine = 4096
+
+// Read reads the next payload. If the context is done before it is read, the connection is closed.
+func (c *StdioConn) Read(ctx context.Context) ([]byte, error) {
+	stop := context.AfterFunc(ctx, func() { _ = c.Close() })
+	defer stop()
+	data, err := c.readPayload()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return data, err
+}
+
+func (c *StdioConn) readPayload() ([]byte, error) {
+	length := int64(-1)
+	for first := true; ; first = false {
+		line, err := c.readLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if first {
+					return nil, io.EOF
+				}
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header line: %q", line)
+		}
+		if textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name)) != "Content-Length" {
+			continue
+		}
+		length, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid Content-Length: %q", value)
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	if length > c.readLimit {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d bytes", errPayloadTooLarge, length, c.readLimit)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+	return data, nil
+}
+
+// readLine reads a header line, without the line ending. Both CRLF and LF line endings are accepted.
+func (c *StdioConn) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := c.r.ReadLine()
+		if err != nil {
+			if len(line) > 0 && errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxHeaderLine {
+			return "", errors.New("header line too long")
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// Write writes the payload with a Content-Length header. If the context is done before it is written,
+// the connection is closed.
+func (c *StdioConn) Write(ctx context.Context, data []byte) error {
+	stop := context.AfterFunc(ctx, func() { _ = c.Close() })
+	defer stop()
+	out := make([]byte, 0, len(data)+32)
+	out = append(out, "Content-Length: "...)
+	out = strconv.AppendInt(out, int64(len(data)), 10)
+	out = append(out, "\r\n\r\n"...)
+	out = append(out, data...)
+	if _, err := c.w.Write(out); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// Close closes both the reader and writer.
+func (c *StdioConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = errors.Join(c.w.Close(), c.rc.Close())
+	})
+	return c.closeErr
+}
+
+// ServeStdio serves the handler over os.Stdin and os.Stdout, until stdin is closed or the context is done.
+// The handler can notify and call the client through the Notifier in the request context.
+// Nothing else must write to os.Stdout: logs should go to os.Stderr.
+func ServeStdio(ctx context.Context, h Handler, opts ...PeerOption) error {
+	peer := NewPeer(NewStdioConn(os.Stdin, os.Stdout, 0), h, opts...)
+	if err := peer.Run(ctx); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestStdioConn(t *testing.T) {
+	read := func(t *testing.T, input string, limit int64) ([]string, error) {
+		t.Helper()
+		conn := NewStdioConn(io.NopCloser(strings.NewReader(input)), nopWriteCloser{io.Discard}, limit)
+		var out []string
+		for {
+			data, err := conn.Read(context.Background())
+			if err != nil {
+				return out, err
+			}
+			out = append(out, string(data))
+		}
+	}
+	t.Run("framing", func(t *testing.T) {
+		out, err := read(t, "Content-Length: 2\r\n\r\n{}"+
+			"content-length: 2\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n[]"+
+			"Content-Length:4\n\nnull", 0)
+		if !errors.Is(err, io.EOF) {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+		if strings.Join(out, " ") != "{} [] null" {
+			t.Fatalf("unexpected payloads: %q", out)
+		}
+	})
+	t.Run("write", func(t *testing.T) {
+		var buf strings.Builder
+		conn := NewStdioConn(io.NopCloser(strings.NewReader("")), nopWriteCloser{&buf}, 0)
+		if err := conn.Write(context.Background(), []byte(`{"jsonrpc":"2.0","method":"exit"}`)); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != "Content-Length: 33\r\n\r\n"+`{"jsonrpc":"2.0","method":"exit"}` {
+			t.Fatalf("unexpected output: %q", got)
+		}
+	})
+	for _, tc := range []struct {
+		name  string
+		input string
+	}{
+		{"missing length", "Content-Type: application/json\r\n\r\n{}"},
+		{"invalid length", "Content-Length: two\r\n\r\n{}"},
+		{"negative length", "Content-Length: -2\r\n\r\n{}"},
+		{"invalid header", "{}\r\n\r\n"},
+		{"truncated header", "Content-Length: 2\r\n"},
+		{"truncated payload", "Content-Length: 10\r\n\r\n{}"},
+		{"long header", "X-Padding: " + strings.Repeat("a", maxHeaderLine) + "\r\n\r\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := read(t, tc.input, 0)
+			if err == nil || errors.Is(err, io.EOF) {
+				t.Fatalf("expected error, got %v", err)
+			}
+		})
+	}
+	t.Run("read limit", func(t *testing.T) {
+		out, err := read(t, "Content-Length: 4\r\n\r\nnullContent-Length: 5\r\n\r\nfalse", 4)
+		if len(out) != 1 || !errors.Is(err, errPayloadTooLarge) {
+			t.Fatalf("expected payload too large after first payload, got %q, %v", out, err)
+		}
+	})
+	t.Run("peer", func(t *testing.T) {
+		clientR, serverW := io.Pipe()
+		serverR, clientW := io.Pipe()
+		server := NewPeer(NewStdioConn(serverR, serverW, 0), specHandler)
+		client := NewPeer(NewStdioConn(clientR, clientW, 0), nil)
+		go func() { _ = server.Run(context.Background()) }()
+		go func() { _ = client.Run(context.Background()) }()
+		defer server.Close()
+		defer client.Close()
+		var result int
+		if err := client.Call(context.Background(), "subtract", []int{42, 23}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 19 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+	})
+}
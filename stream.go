@@ -0,0 +1,194 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// StreamConn is a Conn of concatenated JSON values on a byte stream, as used by geth IPC.
+// Written payloads are followed by a newline, like encoding/json encoders do.
+type StreamConn struct {
+	rwc       io.ReadWriteCloser
+	dec       *json.Decoder
+	budget    *budgetReader
+	readLimit int64
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ Conn = (*StreamConn)(nil)
+
+// NewStreamConn frames payloads on the stream. Payloads larger than the read limit fail to read,
+// or payloads larger than DefaultMaxBodySize if the limit is 0.
+func NewStreamConn(rwc io.ReadWriteCloser, readLimit int64) *StreamConn {
+	if readLimit <= 0 {
+		readLimit = DefaultMaxBodySize
+	}
+	budget := &budgetReader{r: rwc, n: readLimit}
+	return &StreamConn{
+		rwc:       rwc,
+		dec:       json.NewDecoder(budget),
+		budget:    budget,
+		readLimit: readLimit,
+	}
+}
+
+// budgetReader fails reads beyond the remaining budget, to limit the size of decoded values.
+type budgetReader struct {
+	r io.Reader
+	n int64
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		return 0, errPayloadTooLarge
+	}
+	if int64(len(p)) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.r.Read(p)
+	b.n -= int64(n)
+	return n, err
+}
+
+var errPayloadTooLarge = errors.New("payload too large")
+
+// Read reads the next JSON value. If the context is done before it is read, the stream is closed.
+func (c *StreamConn) Read(ctx context.Context) ([]byte, error) {
+	stop := context.AfterFunc(ctx, func() { _ = c.Close() })
+	defer stop()
+	var raw json.RawMessage
+	if err := c.dec.Decode(&raw); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, errPayloadTooLarge) {
+			return nil, fmt.Errorf("%w, limit is %d bytes", err, c.readLimit)
+		}
+		return nil, err
+	}
+	// the next value may use the full limit, except for what is read ahead already
+	buffered, _ := io.Copy(io.Discard, c.dec.Buffered())
+	c.budget.n = c.readLimit - buffered
+	return raw, nil
+}
+
+// Write writes the payload, followed by a newline. If the context is done before it is written, the stream is closed.
+func (c *StreamConn) Write(ctx context.Context, data []byte) error {
+	stop := context.AfterFunc(ctx, func() { _ = c.Close() })
+	defer stop()
+	var buf bytes.Buffer
+	buf.Grow(len(data) + 1)
+	buf.Write(data)
+	buf.WriteByte('\n')
+	if _, err := c.rwc.Write(buf.Bytes()); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *StreamConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.rwc.Close()
+	})
+	return c.closeErr
+}
+
+// streamServer serves each accepted connection with a Peer, using concatenated JSON framing.
+type streamServer struct {
+	listener    net.Listener
+	handler     Handler
+	readLimit   int64
+	peerOptions []PeerOption
+	// prepare returns the context of the handlers of the connection, e.g. after a TLS handshake. Optional.
+	prepare func(conn net.Conn) (context.Context, error)
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newStreamServer(listener net.Listener, h Handler, readLimit int64, peerOptions []PeerOption) *streamServer {
+	return &streamServer{
+		listener:    listener,
+		handler:     h,
+		readLimit:   readLimit,
+		peerOptions: peerOptions,
+		conns:       make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *streamServer) serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *streamServer) serveConn(conn net.Conn) {
+	ctx := context.Background()
+	if s.prepare != nil {
+		var err error
+		if ctx, err = s.prepare(conn); err != nil {
+			_ = conn.Close()
+			return
+		}
+	}
+	peer := NewPeer(NewStreamConn(conn, s.readLimit), s.handler, s.peerOptions...)
+	_ = peer.Run(ctx)
+}
+
+// close stops accepting connections, closes the open connections, and waits for their handlers to return.
+func (s *streamServer) close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	conns := make([]net.Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	err := s.listener.Close()
+	for _, c := range conns {
+		_ = c.Close()
+	}
+	s.wg.Wait()
+	return err
+}
@@ -0,0 +1,87 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestStreamConn(t *testing.T) {
+	t.Run("concatenated", func(t *testing.T) {
+		a, b := net.Pipe()
+		conn := NewStreamConn(a, 0)
+		defer conn.Close()
+		go func() {
+			_, _ = b.Write([]byte(`{"jsonrpc":"2.0","method":"a"}{"jsonrpc":"2.0","method":"b"}` + "\n\t" + `[{"jsonrpc":"2.0","method":"c"}]`))
+		}()
+		for _, expected := range []string{
+			`{"jsonrpc":"2.0","method":"a"}`,
+			`{"jsonrpc":"2.0","method":"b"}`,
+			`[{"jsonrpc":"2.0","method":"c"}]`,
+		} {
+			data, err := conn.Read(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != expected {
+				t.Fatalf("expected %s, got %s", expected, data)
+			}
+		}
+	})
+	t.Run("write", func(t *testing.T) {
+		a, b := net.Pipe()
+		conn := NewStreamConn(a, 0)
+		defer conn.Close()
+		go func() {
+			_ = conn.Write(context.Background(), []byte(`{"jsonrpc":"2.0","method":"a"}`))
+		}()
+		buf := make([]byte, 64)
+		n, err := b.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != `{"jsonrpc":"2.0","method":"a"}`+"\n" {
+			t.Fatalf("unexpected payload: %q", got)
+		}
+	})
+	t.Run("read limit", func(t *testing.T) {
+		a, b := net.Pipe()
+		conn := NewStreamConn(a, 64)
+		defer conn.Close()
+		small := `{"jsonrpc":"2.0","method":"a"}`
+		large := `{"jsonrpc":"2.0","method":"` + strings.Repeat("a", 100) + `"}`
+		go func() {
+			_, _ = b.Write([]byte(small + small + small + large))
+		}()
+		for i := 0; i < 3; i++ {
+			if _, err := conn.Read(context.Background()); err != nil {
+				t.Fatalf("message %d: %v", i, err)
+			}
+		}
+		if _, err := conn.Read(context.Background()); !errors.Is(err, errPayloadTooLarge) {
+			t.Fatalf("expected payload too large, got %v", err)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		a, b := net.Pipe()
+		conn := NewStreamConn(a, 0)
+		defer conn.Close()
+		go func() {
+			_, _ = b.Write([]byte(`{"jsonrpc":]`))
+		}()
+		if _, err := conn.Read(context.Background()); err == nil {
+			t.Fatal("expected syntax error")
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		a, _ := net.Pipe()
+		conn := NewStreamConn(a, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := conn.Read(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,230 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// StrictJSON rejects messages that JSON parsers may interpret differently,
+// to avoid parser differentials between proxies and backends:
+// duplicate keys in any object, standard member names that do not match in case (e.g. "METHOD"),
+// and strings with invalid UTF-8 or lone UTF-16 surrogates.
+// Violations are reported as MessageError with InvalidRequest code.
+// Servers decode requests strictly with the DecodeOptions serve option.
+func StrictJSON() MessageOption {
+	return func(cfg *messageConfig) {
+		cfg.strictJSON = true
+	}
+}
+
+// objects with more keys than this use a map to detect duplicate keys
+const maxLinearKeys = 16
+
+const (
+	strictValueAny = iota
+	strictValueMessage
+	strictValueError
+)
+
+// checkStrictJSON checks the message data for the constraints of StrictJSON.
+func checkStrictJSON(data []byte) error {
+	i := scanSpace(data, 0)
+	end, err := strictValue(data, i, 0, strictValueMessage)
+	if err != nil {
+		return asMessageError(err, ParseErr)
+	}
+	if end = scanSpace(data, end); end != len(data) {
+		return asMessageError(scanSyntaxErr(data, end, "after top-level value"), ParseErr)
+	}
+	return nil
+}
+
+func strictValue(data []byte, i int, depth int, kind int) (int, error) {
+	if i >= len(data) {
+		return i, errUnexpectedEnd
+	}
+	switch data[i] {
+	case '"':
+		end, err := scanString(data, i)
+		if err != nil {
+			return end, err
+		}
+		return end, checkStrictString(data[i:end])
+	case '[', '{':
+		if depth >= maxScanDepth {
+			return i, errors.New("exceeded max JSON nesting depth")
+		}
+		if data[i] == '[' {
+			return strictArray(data, i, depth+1)
+		}
+		return strictObject(data, i, depth+1, kind)
+	default:
+		return scanValueDepth(data, i, depth)
+	}
+}
+
+func strictArray(data []byte, i int, depth int) (int, error) {
+	i = scanSpace(data, i+1)
+	if i < len(data) && data[i] == ']' {
+		return i + 1, nil
+	}
+	for {
+		end, err := strictValue(data, i, depth, strictValueAny)
+		if err != nil {
+			return end, err
+		}
+		i = scanSpace(data, end)
+		if i >= len(data) {
+			return i, errUnexpectedEnd
+		}
+		switch data[i] {
+		case ',':
+			i = scanSpace(data, i+1)
+		case ']':
+			return i + 1, nil
+		default:
+			return i, scanSyntaxErr(data, i, "after array element")
+		}
+	}
+}
+
+func strictObject(data []byte, i int, depth int, kind int) (int, error) {
+	i = scanSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return i + 1, nil
+	}
+	var keys []span
+	var keySet map[string]struct{}
+	for {
+		if i >= len(data) {
+			return i, errUnexpectedEnd
+		}
+		if data[i] != '"' {
+			return i, scanSyntaxErr(data, i, "looking for beginning of object key string")
+		}
+		keyEnd, err := scanString(data, i)
+		if err != nil {
+			return keyEnd, err
+		}
+		key := data[i:keyEnd]
+		if err := checkStrictString(key); err != nil {
+			return i, err
+		}
+		if err := checkMemberCase(key, kind); err != nil {
+			return i, err
+		}
+		// detect duplicates linearly for small objects, and with a map for large objects
+		if keySet == nil {
+			for _, k := range keys {
+				if sameString(k.of(data), key) {
+					return i, invalidRequest(fmt.Errorf("duplicate key %s", key))
+				}
+			}
+			keys = append(keys, span{start: i, end: keyEnd})
+			if len(keys) > maxLinearKeys {
+				keySet = make(map[string]struct{}, len(keys))
+				for _, k := range keys {
+					keySet[unquoteString(k.of(data))] = struct{}{}
+				}
+			}
+		} else {
+			k := unquoteString(key)
+			if _, ok := keySet[k]; ok {
+				return i, invalidRequest(fmt.Errorf("duplicate key %s", key))
+			}
+			keySet[k] = struct{}{}
+		}
+		i = scanSpace(data, keyEnd)
+		if i >= len(data) || data[i] != ':' {
+			return i, scanSyntaxErr(data, i, "after object key")
+		}
+		valueKind := strictValueAny
+		if kind == strictValueMessage && string(key) == `"error"` {
+			valueKind = strictValueError
+		}
+		end, err := strictValue(data, scanSpace(data, i+1), depth, valueKind)
+		if err != nil {
+			return end, err
+		}
+		i = scanSpace(data, end)
+		if i >= len(data) {
+			return i, errUnexpectedEnd
+		}
+		switch data[i] {
+		case ',':
+			i = scanSpace(data, i+1)
+		case '}':
+			return i + 1, nil
+		default:
+			return i, scanSyntaxErr(data, i, "after object key:value pair")
+		}
+	}
+}
+
+// checkMemberCase rejects keys of messages and error objects that only match a standard member case-insensitively.
+func checkMemberCase(key []byte, kind int) error {
+	var names []string
+	switch kind {
+	case strictValueMessage:
+		names = []string{"jsonrpc", "id", "method", "params", "result", "error"}
+	case strictValueError:
+		names = []string{"code", "message", "data"}
+	default:
+		return nil
+	}
+	for _, name := range names {
+		if matchKey(key, name) && !stringEquals(key, name) {
+			return invalidRequest(fmt.Errorf("member %s must be %q", key, name))
+		}
+	}
+	return nil
+}
+
+// sameString checks if two valid JSON strings (including quotes) are equal after unescaping.
+func sameString(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	if bytes.IndexByte(a, '\\') < 0 && bytes.IndexByte(b, '\\') < 0 {
+		return false
+	}
+	return unquoteString(a) == unquoteString(b)
+}
+
+// checkStrictString rejects invalid UTF-8 and lone surrogates in the valid JSON string (including quotes).
+func checkStrictString(s []byte) error {
+	raw := s[1 : len(s)-1]
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		if c == '\\' {
+			if raw[i+1] != 'u' {
+				i += 2
+				continue
+			}
+			r := hexRune(raw[i+2 : i+6])
+			i += 6
+			if !utf16.IsSurrogate(r) {
+				continue
+			}
+			if r >= 0xDC00 || i+6 > len(raw) || raw[i] != '\\' || raw[i+1] != 'u' ||
+				utf16.DecodeRune(r, hexRune(raw[i+2:i+6])) == utf8.RuneError {
+				return invalidRequest(fmt.Errorf("lone surrogate in string %s", s))
+			}
+			i += 6
+			continue
+		}
+		if c < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(raw[i:])
+		if r == utf8.RuneError && size == 1 {
+			return invalidRequest(errors.New("invalid UTF-8 in string"))
+		}
+		i += size
+	}
+	return nil
+}
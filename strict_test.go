@@ -0,0 +1,79 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStrictJSON(t *testing.T) {
+	t.Run("accepted", func(t *testing.T) {
+		for _, data := range []string{
+			`{"jsonrpc": "2.0", "method": "eth_call", "id": 1, "params": [{"to": "0x00", "data": "😀 é"}]}`,
+			`{"jsonrpc": "2.0", "id": "a", "error": {"code": -32601, "message": "not found", "data": {"x": 1, "X": 2}}}`,
+			`{"jsonrpc": "2.0", "method": "foo", "x-trace": {"id": 1}}`,
+		} {
+			if _, err := DecodeMessage([]byte(data), StrictJSON()); err != nil {
+				t.Fatalf("unexpected error for %s: %v", data, err)
+			}
+		}
+	})
+	var manyKeys strings.Builder
+	manyKeys.WriteString(`{"jsonrpc": "2.0", "method": "foo", "params": {`)
+	for i := 0; i < 20; i++ {
+		manyKeys.WriteString(`"k` + string(rune('a'+i)) + `": 1, `)
+	}
+	manyKeys.WriteString(`"ka": 2}}`)
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{"duplicate id", `{"jsonrpc": "2.0", "method": "foo", "id": 1, "id": 2}`},
+		{"duplicate escaped", `{"jsonrpc": "2.0", "method": "foo", "id": 1, "\u0069d": 2}`},
+		{"duplicate nested", `{"jsonrpc": "2.0", "method": "foo", "params": [{"a": 1, "a": 2}]}`},
+		{"duplicate many keys", manyKeys.String()},
+		{"member case", `{"jsonrpc": "2.0", "METHOD": "foo"}`},
+		{"error member case", `{"jsonrpc": "2.0", "id": 1, "error": {"Code": -32000, "message": "x"}}`},
+		{"invalid utf8", "{\"jsonrpc\": \"2.0\", \"method\": \"foo\xff\"}"},
+		{"invalid utf8 key", "{\"jsonrpc\": \"2.0\", \"method\": \"foo\", \"params\": {\"\xc3\": 1}}"},
+		{"lone high surrogate", `{"jsonrpc": "2.0", "method": "foo\ud83d"}`},
+		{"lone low surrogate", `{"jsonrpc": "2.0", "method": "\ude00foo"}`},
+		{"unpaired surrogates", `{"jsonrpc": "2.0", "method": "\ud83dA"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DecodeMessage([]byte(tc.data)); err != nil {
+				t.Fatalf("expected lenient decoding to succeed: %v", err)
+			}
+			_, err := DecodeMessage([]byte(tc.data), StrictJSON())
+			if !errors.Is(err, InvalidRequest) {
+				t.Fatalf("expected InvalidRequest error, got %v", err)
+			}
+		})
+	}
+	t.Run("serve", func(t *testing.T) {
+		h := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			return req.Respond(true)
+		})
+		payload := []byte(`[{"jsonrpc": "2.0", "method": "foo", "id": 1}, {"jsonrpc": "2.0", "method": "foo", "id": 2, "METHOD": "bar"}]`)
+		if out := Serve(context.Background(), payload, h); string(out) != `[{"result":true,"id":1,"jsonrpc":"2.0"},{"result":true,"id":2,"jsonrpc":"2.0"}]` {
+			t.Fatalf("expected lenient serving by default, got %s", out)
+		}
+		out := Serve(context.Background(), payload, h, DecodeOptions(StrictJSON()))
+		var resps []*Message
+		if err := json.Unmarshal(out, &resps); err != nil {
+			t.Fatal(err)
+		}
+		if len(resps) != 2 || resps[0].Error != nil || resps[1].ID != "2" ||
+			resps[1].Error == nil || resps[1].Error.Code != InvalidRequest.Code() {
+			t.Fatalf("expected the strict batch element to be rejected, got %s", out)
+		}
+	})
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := DecodeMessage([]byte(`{"jsonrpc": "2.0", "method": "foo"`), StrictJSON())
+		if err == nil || errors.Is(err, InvalidRequest) {
+			t.Fatalf("expected syntax error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"time"
+)
+
+// tlsHandshakeTimeout limits how long a TCP server waits for a client to complete the TLS handshake.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TCPOption configures TCP servers and connections.
+type TCPOption func(cfg *tcpConfig)
+
+type tcpConfig struct {
+	tls         *tls.Config
+	readLimit   int64
+	peerOptions []PeerOption
+}
+
+func newTCPConfig(opts []TCPOption) tcpConfig {
+	var cfg tcpConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// TCPTLSConfig enables TLS. For mutual TLS, servers set ClientAuth and ClientCAs,
+// and the verified client certificate is available to handlers with PeerIdentityFromContext.
+func TCPTLSConfig(cfg *tls.Config) TCPOption {
+	return func(c *tcpConfig) {
+		c.tls = cfg
+	}
+}
+
+// TCPReadLimit limits the size of received payloads, DefaultMaxBodySize by default.
+func TCPReadLimit(n int64) TCPOption {
+	return func(cfg *tcpConfig) {
+		cfg.readLimit = n
+	}
+}
+
+// TCPPeerOptions configures the peers of connections served by TCPServer.
+func TCPPeerOptions(opts ...PeerOption) TCPOption {
+	return func(cfg *tcpConfig) {
+		cfg.peerOptions = append(cfg.peerOptions, opts...)
+	}
+}
+
+// PeerIdentity is the verified certificate of a mutual TLS client.
+type PeerIdentity struct {
+	Subject     pkix.Name
+	Certificate *x509.Certificate
+	// RemoteAddr is the network address of the client.
+	RemoteAddr net.Addr
+}
+
+type peerIdentityKey struct{}
+
+// PeerIdentityFromContext returns the identity of the client that sent the request,
+// if it presented a certificate that was verified with mutual TLS.
+func PeerIdentityFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	id, ok := ctx.Value(peerIdentityKey{}).(*PeerIdentity)
+	return id, ok
+}
+
+// TCPServer serves JSON-RPC on a TCP listener, with concatenated JSON messages, optionally over TLS.
+// Each connection is served by a Peer, so handlers can notify the client with the Notifier in the request context.
+type TCPServer struct {
+	listener net.Listener
+	srv      *streamServer
+}
+
+// ListenTCP listens on the address, e.g. "127.0.0.1:0". Serve must be called to accept connections.
+func ListenTCP(addr string, h Handler, opts ...TCPOption) (*TCPServer, error) {
+	cfg := newTCPConfig(opts)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := newStreamServer(listener, h, cfg.readLimit, cfg.peerOptions)
+	if cfg.tls != nil {
+		srv.listener = tls.NewListener(listener, cfg.tls)
+		srv.prepare = prepareTLS
+	}
+	return &TCPServer{listener: listener, srv: srv}, nil
+}
+
+// prepareTLS completes the handshake, and provides the identity of a verified client to handlers.
+func prepareTLS(conn net.Conn) (context.Context, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	tlsConn := conn.(*tls.Conn)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return context.Background(), nil
+	}
+	cert := state.VerifiedChains[0][0]
+	return context.WithValue(context.Background(), peerIdentityKey{}, &PeerIdentity{
+		Subject:     cert.Subject,
+		Certificate: cert,
+		RemoteAddr:  conn.RemoteAddr(),
+	}), nil
+}
+
+// Addr returns the address the server listens on.
+func (s *TCPServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accepts and serves connections, until the server is closed. It returns nil after Close.
+func (s *TCPServer) Serve() error {
+	return s.srv.serve()
+}
+
+// Close stops accepting connections, closes the open connections, and waits for their handlers to return.
+func (s *TCPServer) Close() error {
+	return s.srv.close()
+}
+
+// DialTCP connects to the address, with TLS if configured with TCPTLSConfig.
+// The returned connection is used with NewPeer, to call the server.
+func DialTCP(ctx context.Context, addr string, opts ...TCPOption) (*StreamConn, error) {
+	cfg := newTCPConfig(opts)
+	var conn net.Conn
+	var err error
+	if cfg.tls != nil {
+		d := tls.Dialer{Config: cfg.tls}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamConn(conn, cfg.readLimit), nil
+}
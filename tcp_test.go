@@ -0,0 +1,139 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+func newTCPServer(t *testing.T, h Handler, opts ...TCPOption) *TCPServer {
+	t.Helper()
+	srv, err := ListenTCP("127.0.0.1:0", h, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve() }()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		if err := <-served; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return srv
+}
+
+func dialTCPPeer(t *testing.T, addr string, opts ...TCPOption) *Peer {
+	t.Helper()
+	conn, err := DialTCP(context.Background(), addr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := NewPeer(conn, nil)
+	go func() { _ = peer.Run(context.Background()) }()
+	t.Cleanup(func() { _ = peer.Close() })
+	return peer
+}
+
+func TestTCP(t *testing.T) {
+	ca, err := newTestCA("test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := ca.Issue("server", "127.0.0.1", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := ca.Issue("client-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, err := newTestCA("other CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert, err := otherCA.Issue("client-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	whoami := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		if req.Method != "whoami" {
+			return specHandler(ctx, req)
+		}
+		id, ok := PeerIdentityFromContext(ctx)
+		if !ok {
+			return req.Respond("")
+		}
+		return req.Respond(id.Subject.CommonName)
+	})
+	call := func(t *testing.T, peer *Peer) string {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var name string
+		if err := peer.Call(ctx, "whoami", nil, &name); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		srv := newTCPServer(t, whoami)
+		peer := dialTCPPeer(t, srv.Addr().String())
+		var result int
+		if err := peer.Call(context.Background(), "subtract", []int{42, 23}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 19 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+		if name := call(t, peer); name != "" {
+			t.Fatalf("unexpected identity: %q", name)
+		}
+	})
+	t.Run("tls", func(t *testing.T) {
+		srv := newTCPServer(t, whoami, TCPTLSConfig(&tls.Config{Certificates: []tls.Certificate{serverCert}}))
+		peer := dialTCPPeer(t, srv.Addr().String(), TCPTLSConfig(&tls.Config{RootCAs: ca.CertPool()}))
+		if name := call(t, peer); name != "" {
+			t.Fatalf("unexpected identity: %q", name)
+		}
+		if _, err := DialTCP(context.Background(), srv.Addr().String(), TCPTLSConfig(&tls.Config{RootCAs: otherCA.CertPool()})); err == nil {
+			t.Fatal("expected untrusted server certificate to fail")
+		}
+	})
+	t.Run("mutual tls", func(t *testing.T) {
+		srv := newTCPServer(t, whoami, TCPTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    ca.CertPool(),
+		}))
+		peer := dialTCPPeer(t, srv.Addr().String(), TCPTLSConfig(&tls.Config{
+			RootCAs:      ca.CertPool(),
+			Certificates: []tls.Certificate{clientCert},
+		}))
+		if name := call(t, peer); name != "client-1" {
+			t.Fatalf("unexpected identity: %q", name)
+		}
+
+		// with TLS 1.3, the client only learns about a rejected certificate when it reads
+		for _, cert := range [][]tls.Certificate{nil, {otherCert}} {
+			conn, err := DialTCP(context.Background(), srv.Addr().String(), TCPTLSConfig(&tls.Config{
+				RootCAs:      ca.CertPool(),
+				Certificates: cert,
+			}))
+			if err != nil {
+				continue
+			}
+			peer := NewPeer(conn, nil)
+			go func() { _ = peer.Run(context.Background()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err = peer.Call(ctx, "whoami", nil, nil)
+			cancel()
+			_ = peer.Close()
+			if err == nil {
+				t.Fatal("expected client without trusted certificate to be rejected")
+			}
+		}
+	})
+}
@@ -0,0 +1,339 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Validator is implemented by params types, and types nested within params,
+// that validate themselves after ParamsDecoder decoded them.
+type Validator interface {
+	Validate() error
+}
+
+var validatorType = reflect.TypeFor[Validator]()
+
+// The "validate" struct tag declares constraints on a struct field, checked after decoding:
+//
+//	required       the value must not be zero (a nil pointer, empty string, 0, etc.)
+//	min=N, max=N   the length of a string, slice, array or map must be at least / at most N
+//	hex            a string must be 0x-prefixed hexadecimal
+//	enum=a|b|c     a string must be one of the listed values
+//
+// Options are comma-separated, e.g. `validate:"required,hex,max=66"`.
+// Pointers are dereferenced before checking, and constraints other than required are not checked for zero values,
+// so optional params only have to satisfy the constraints if they are set.
+const validateTag = "validate"
+
+type fieldRules struct {
+	required bool
+	hex      bool
+	// -1 if not set
+	min, max int
+	enum     []string
+}
+
+func parseRules(f reflect.StructField) (*fieldRules, error) {
+	tag, ok := f.Tag.Lookup(validateTag)
+	if !ok || tag == "" {
+		return nil, nil
+	}
+	typ := f.Type
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	r := &fieldRules{min: -1, max: -1}
+	for _, opt := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(opt, "=")
+		switch name {
+		case "required":
+			r.required = true
+		case "min", "max":
+			switch typ.Kind() {
+			case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			default:
+				return nil, fmt.Errorf("field %s: %s constraint requires a type with a length, got %s", f.Name, name, typ)
+			}
+			n, err := strconv.ParseUint(arg, 10, 31)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: invalid %s constraint %q", f.Name, name, arg)
+			}
+			if name == "min" {
+				r.min = int(n)
+			} else {
+				r.max = int(n)
+			}
+		case "hex", "enum":
+			if typ.Kind() != reflect.String {
+				return nil, fmt.Errorf("field %s: %s constraint requires a string type, got %s", f.Name, name, typ)
+			}
+			if name == "hex" {
+				r.hex = true
+			} else {
+				r.enum = strings.Split(arg, "|")
+			}
+		default:
+			return nil, fmt.Errorf("field %s: unknown validate tag option %q", f.Name, opt)
+		}
+	}
+	return r, nil
+}
+
+func (r *fieldRules) check(v reflect.Value) error {
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.IsZero() {
+		if r.required {
+			return errors.New("required")
+		}
+		return nil
+	}
+	if r.min >= 0 && v.Len() < r.min {
+		return fmt.Errorf("length %d is less than minimum %d", v.Len(), r.min)
+	}
+	if r.max >= 0 && v.Len() > r.max {
+		return fmt.Errorf("length %d is more than maximum %d", v.Len(), r.max)
+	}
+	if r.hex && !isHex(v.String()) {
+		return errors.New("must be 0x-prefixed hex")
+	}
+	if r.enum != nil && !slices.Contains(r.enum, v.String()) {
+		return fmt.Errorf("must be one of: %s", strings.Join(r.enum, ", "))
+	}
+	return nil
+}
+
+func isHex(s string) bool {
+	if len(s) < 2 || s[0] != '0' || (s[1] != 'x' && s[1] != 'X') {
+		return false
+	}
+	for _, c := range s[2:] {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// typeValidation describes what to validate in values of a type.
+type typeValidation struct {
+	// the type implements Validator
+	self bool
+	// a pointer to the type implements Validator
+	ptrSelf bool
+	// struct fields to validate
+	fields []fieldValidation
+	// the element type of pointers, slices, arrays and maps, if it needs validation
+	elem *typeValidation
+}
+
+type fieldValidation struct {
+	// index sequence of the field, through embedded structs, as used by reflect.Value.FieldByIndex
+	index []int
+	name  string
+	// the params field, if the field is validated as part of the params layout
+	param *paramField
+	rules *fieldRules
+	// nil if the field type does not need validation
+	typ *typeValidation
+}
+
+var typeValidations sync.Map // reflect.Type -> *typeValidation
+
+// validationOf determines what to validate in values of the given type, and caches it.
+// It returns nil if there is nothing to validate.
+func validationOf(typ reflect.Type) (*typeValidation, error) {
+	return buildValidation(typ, make(map[reflect.Type]*typeValidation))
+}
+
+func buildValidation(typ reflect.Type, seen map[reflect.Type]*typeValidation) (*typeValidation, error) {
+	if v, ok := typeValidations.Load(typ); ok {
+		return v.(*typeValidation), nil
+	}
+	if tv, ok := seen[typ]; ok { // recursive type
+		return tv, nil
+	}
+	tv := &typeValidation{}
+	seen[typ] = tv
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		elem, err := buildValidation(typ.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		tv.elem = elem
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			rules, err := parseRules(f)
+			if err != nil {
+				return nil, err
+			}
+			ft, err := buildValidation(f.Type, seen)
+			if err != nil {
+				return nil, err
+			}
+			if rules != nil || ft != nil {
+				tv.fields = append(tv.fields, fieldValidation{index: f.Index, name: jsonName(f), rules: rules, typ: ft})
+			}
+		}
+	}
+	// pointers are validated through their element, which is addressable
+	if typ.Kind() != reflect.Pointer {
+		tv.self = typ.Implements(validatorType)
+		tv.ptrSelf = !tv.self && reflect.PointerTo(typ).Implements(validatorType)
+	}
+	if !tv.self && !tv.ptrSelf && tv.elem == nil && len(tv.fields) == 0 {
+		tv = nil
+	}
+	typeValidations.Store(typ, tv)
+	return tv, nil
+}
+
+// paramsValidation determines what to validate in params decoded into the struct type with the given layout.
+// Only the fields of the layout are validated, including those of embedded structs,
+// since other fields are never decoded from params.
+// It returns nil if there is nothing to validate.
+func paramsValidation(typ reflect.Type, layout *paramsLayout) (*typeValidation, error) {
+	base, err := validationOf(typ)
+	if err != nil {
+		return nil, err
+	}
+	tv := &typeValidation{}
+	if base != nil {
+		tv.self, tv.ptrSelf = base.self, base.ptrSelf
+	}
+	seen := make(map[reflect.Type]*typeValidation)
+	for i := range layout.fields {
+		pf := &layout.fields[i]
+		f := typ.FieldByIndex(pf.index)
+		rules, err := parseRules(f)
+		if err != nil {
+			return nil, err
+		}
+		ft, err := buildValidation(f.Type, seen)
+		if err != nil {
+			return nil, err
+		}
+		if rules != nil || ft != nil {
+			tv.fields = append(tv.fields, fieldValidation{index: pf.index, name: jsonName(f), param: pf, rules: rules, typ: ft})
+		}
+	}
+	if !tv.self && !tv.ptrSelf && len(tv.fields) == 0 {
+		return nil, nil
+	}
+	return tv, nil
+}
+
+// validateParams validates the decoded params value v. If v is a struct, tv must be from paramsValidation,
+// and named indicates whether it was decoded from named params, to describe the failing params accordingly.
+func (tv *typeValidation) validateParams(v reflect.Value, named bool) []*ParamError {
+	var errs []*ParamError
+	if v.Kind() != reflect.Struct {
+		tv.validate(v, -1, "", "$", &errs)
+		return errs
+	}
+	for _, fv := range tv.fields {
+		index, name, path := -1, "", "$."+fv.name
+		if f := fv.param; named && f.name != "" {
+			name, path = f.name, "$."+f.name
+		} else if !named {
+			index, path = f.pos, "$["+strconv.Itoa(f.pos)+"]"
+		}
+		fv.validate(v, index, name, path, &errs)
+	}
+	tv.validateSelf(v, -1, "", "$", &errs)
+	return errs
+}
+
+func (tv *typeValidation) validate(v reflect.Value, index int, name string, path string, errs *[]*ParamError) {
+	if tv == nil {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			tv.elem.validate(v.Elem(), index, name, path, errs)
+		}
+		return
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			tv.elem.validate(v.Index(i), index, name, path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			tv.elem.validate(iter.Value(), index, name, path+"["+fmt.Sprint(iter.Key())+"]", errs)
+		}
+	case reflect.Struct:
+		for _, fv := range tv.fields {
+			fv.validate(v, index, name, path+"."+fv.name, errs)
+		}
+	}
+	tv.validateSelf(v, index, name, path, errs)
+}
+
+func (tv *typeValidation) validateSelf(v reflect.Value, index int, name string, path string, errs *[]*ParamError) {
+	var err error
+	if tv.self {
+		err = v.Interface().(Validator).Validate()
+	} else if tv.ptrSelf {
+		if !v.CanAddr() { // e.g. map values
+			cp := reflect.New(v.Type()).Elem()
+			cp.Set(v)
+			v = cp
+		}
+		err = v.Addr().Interface().(Validator).Validate()
+	}
+	if err != nil {
+		*errs = append(*errs, newValidationError(index, name, path, v, err))
+	}
+}
+
+func (fv *fieldValidation) validate(parent reflect.Value, index int, name string, path string, errs *[]*ParamError) {
+	v, err := parent.FieldByIndexErr(fv.index)
+	if err != nil { // in a nil embedded struct pointer
+		v = reflect.Zero(parent.Type().FieldByIndex(fv.index).Type)
+	}
+	if fv.rules != nil {
+		if err := fv.rules.check(v); err != nil {
+			*errs = append(*errs, newValidationError(index, name, path, v, err))
+			return
+		}
+	}
+	fv.typ.validate(v, index, name, path, errs)
+}
+
+func newValidationError(index int, name string, path string, v reflect.Value, err error) *ParamError {
+	value, _ := json.Marshal(v.Interface())
+	return &ParamError{
+		Index:   index,
+		Name:    name,
+		Path:    path,
+		Type:    v.Type().String(),
+		Snippet: snippet(value),
+		Err:     err,
+	}
+}
+
+// jsonName returns the name of the struct field in JSON objects.
+func jsonName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
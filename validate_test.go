@@ -0,0 +1,163 @@
+package jsonrpc
+
+import (
+	"errors"
+	"testing"
+)
+
+type blockRange struct {
+	From uint64 `json:"fromBlock"`
+	To   uint64 `json:"toBlock"`
+}
+
+func (r *blockRange) Validate() error {
+	if r.To < r.From {
+		return errors.New("toBlock before fromBlock")
+	}
+	return nil
+}
+
+type validatedObj struct {
+	Addr   string       `json:"address" validate:"required,hex,max=42"`
+	Tag    string       `json:"tag" param:",optional" validate:"enum=latest|pending"`
+	Ranges []blockRange `json:"ranges" param:",optional"`
+}
+
+func (o validatedObj) Validate() error {
+	if o.Tag == "pending" && len(o.Ranges) > 0 {
+		return errors.New("cannot combine pending tag with ranges")
+	}
+	return nil
+}
+
+func TestParamsValidation(t *testing.T) {
+	dec := ParamsDecoder[validatedObj]()
+	t.Run("valid", func(t *testing.T) {
+		got, err := dec(Params(`["0xaa", "latest", [{"fromBlock": 1, "toBlock": 2}]]`))
+		if err != nil {
+			t.Fatal("must accept valid params. Err:", err)
+		}
+		if got.Addr != "0xaa" || len(got.Ranges) != 1 {
+			t.Fatal("unexpected values")
+		}
+	})
+	t.Run("optional zero values", func(t *testing.T) {
+		if _, err := dec(Params(`["0xaa"]`)); err != nil {
+			t.Fatal("must not check constraints of omitted params. Err:", err)
+		}
+	})
+	t.Run("required", func(t *testing.T) {
+		_, err := dec(Params(`{"tag": "latest"}`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 1 || pErr.Params[0].Name != "address" || pErr.Params[0].Path != "$.address" {
+			t.Fatalf("unexpected params error: %v", err)
+		}
+		if obj := pErr.ErrorObject(); obj.Code != InvalidParams.Code() {
+			t.Fatalf("unexpected error code %d", obj.Code)
+		}
+	})
+	t.Run("constraints", func(t *testing.T) {
+		cases := []string{
+			`["0xzz"]`,
+			`["0x0000000000000000000000000000000000000000aa"]`,
+			`["0xaa", "earliest"]`,
+		}
+		for _, c := range cases {
+			if _, err := dec(Params(c)); err == nil {
+				t.Errorf("expected constraint failure for %s", c)
+			}
+		}
+	})
+	t.Run("nested validator", func(t *testing.T) {
+		_, err := dec(Params(`["0xaa", "latest", [{"fromBlock": 1, "toBlock": 2}, {"fromBlock": 3, "toBlock": 2}]]`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 1 || pErr.Params[0].Index != 2 || pErr.Params[0].Path != "$[2][1]" {
+			t.Fatalf("unexpected params error: %v", err)
+		}
+	})
+	t.Run("top-level validator", func(t *testing.T) {
+		_, err := dec(Params(`["0xaa", "pending", [{"fromBlock": 1, "toBlock": 2}]]`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 1 || pErr.Params[0].Path != "$" {
+			t.Fatalf("unexpected params error: %v", err)
+		}
+	})
+	t.Run("validation error code", func(t *testing.T) {
+		_, err := ParamsDecoder[*validatedObj](ValidationErrorCode(InvalidInput))(Params(`["0xzz"]`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if obj := pErr.ErrorObject(); obj.Code != InvalidInput.Code() {
+			t.Fatalf("unexpected error code %d", obj.Code)
+		}
+		// decoding failures remain invalid params
+		_, err = ParamsDecoder[*validatedObj](ValidationErrorCode(InvalidInput))(Params(`[1]`))
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if obj := pErr.ErrorObject(); obj.Code != InvalidParams.Code() {
+			t.Fatalf("unexpected error code %d", obj.Code)
+		}
+	})
+	t.Run("list of validators", func(t *testing.T) {
+		_, err := ParamsDecoder[[]blockRange]()(Params(`[{"fromBlock": 3, "toBlock": 2}]`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 1 || pErr.Params[0].Path != "$[0]" {
+			t.Fatalf("unexpected params error: %v", err)
+		}
+	})
+	t.Run("skipped field", func(t *testing.T) {
+		type obj struct {
+			Addr  string `json:"address"`
+			Cache string `param:"-" validate:"required"`
+		}
+		if _, err := ParamsDecoder[obj]()(Params(`["0xaa"]`)); err != nil {
+			t.Fatal("must not validate fields that are not params. Err:", err)
+		}
+	})
+	t.Run("embedded field", func(t *testing.T) {
+		type inner struct {
+			Addr string `json:"address" validate:"hex"`
+		}
+		type obj struct {
+			inner
+			Tag string `json:"tag"`
+		}
+		_, err := ParamsDecoder[obj]()(Params(`{"address": "0xzz", "tag": "latest"}`))
+		var pErr *ParamsError
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 1 || pErr.Params[0].Name != "address" || pErr.Params[0].Path != "$.address" {
+			t.Fatalf("unexpected params error: %v", err)
+		}
+		_, err = ParamsDecoder[obj]()(Params(`["0xzz", "latest"]`))
+		if !errors.As(err, &pErr) {
+			t.Fatalf("expected ParamsError, got %v", err)
+		}
+		if len(pErr.Params) != 1 || pErr.Params[0].Index != 0 || pErr.Params[0].Path != "$[0]" {
+			t.Fatalf("unexpected params error: %v", err)
+		}
+	})
+	t.Run("invalid tags", func(t *testing.T) {
+		type obj struct {
+			N int `validate:"hex"`
+		}
+		if _, err := ParamsDecoder[obj]()(Params(`[1]`)); err == nil {
+			t.Fatal("expected error for hex constraint on int")
+		}
+	})
+}
@@ -0,0 +1,677 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// The websocket implementation below follows RFC 6455, without extensions or subprotocols.
+// Messages are sent as text frames, and may be received as text or binary frames.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// close status codes
+const (
+	wsCloseNormal          = 1000
+	wsCloseProtocolError   = 1002
+	wsCloseNoStatus        = 1005
+	wsCloseInvalidPayload  = 1007
+	wsCloseMessageTooBig   = 1009
+	wsMaxControlPayloadLen = 125
+)
+
+// time to wait for the close frame of the peer, and for writing control frames
+const (
+	wsCloseTimeout = time.Second
+	wsWriteTimeout = 10 * time.Second
+)
+
+// DefaultPingInterval is the default interval of websocket keepalive pings.
+const DefaultPingInterval = 30 * time.Second
+
+// CloseError is returned by WebSocketConn.Read when the connection is closed with a close frame.
+// Code is the RFC 6455 status code, e.g. 1000 for a normal closure, or 1009 for a message that is too big.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed with status %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed with status %d: %s", e.Code, e.Reason)
+}
+
+// WebSocketOption configures websocket connections.
+type WebSocketOption func(cfg *wsConfig)
+
+type wsConfig struct {
+	readLimit    int64
+	pingInterval time.Duration
+	frameSize    int
+	header       http.Header
+	checkOrigin  func(r *http.Request) bool
+	peerOptions  []PeerOption
+}
+
+func newWSConfig(opts []WebSocketOption) wsConfig {
+	cfg := wsConfig{
+		readLimit:    DefaultMaxBodySize,
+		pingInterval: DefaultPingInterval,
+		header:       http.Header{},
+		checkOrigin:  sameOrigin,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WebSocketReadLimit limits the size of received messages, DefaultMaxBodySize by default.
+// Larger messages close the connection with status 1009.
+func WebSocketReadLimit(n int64) WebSocketOption {
+	return func(cfg *wsConfig) {
+		cfg.readLimit = n
+	}
+}
+
+// WebSocketPingInterval sets the interval of keepalive pings, DefaultPingInterval by default, or disables them if 0.
+// If nothing is received for two intervals while reading, the connection is considered dead and closed.
+func WebSocketPingInterval(d time.Duration) WebSocketOption {
+	return func(cfg *wsConfig) {
+		cfg.pingInterval = d
+	}
+}
+
+// WebSocketFrameSize fragments written messages into frames of at most n bytes. By default, messages are not fragmented.
+func WebSocketFrameSize(n int) WebSocketOption {
+	return func(cfg *wsConfig) {
+		cfg.frameSize = n
+	}
+}
+
+// WebSocketHeader adds a header to the handshake request of DialWebSocket, e.g. an authorization token.
+func WebSocketHeader(key, value string) WebSocketOption {
+	return func(cfg *wsConfig) {
+		cfg.header.Add(key, value)
+	}
+}
+
+// WebSocketCheckOrigin sets the check of the Origin header of handshake requests.
+// By default, only requests without Origin header, or with an Origin of the same host, are accepted.
+func WebSocketCheckOrigin(fn func(r *http.Request) bool) WebSocketOption {
+	return func(cfg *wsConfig) {
+		cfg.checkOrigin = fn
+	}
+}
+
+// WebSocketPeerOptions configures the peers of connections served by WebSocketHandler.
+func WebSocketPeerOptions(opts ...PeerOption) WebSocketOption {
+	return func(cfg *wsConfig) {
+		cfg.peerOptions = append(cfg.peerOptions, opts...)
+	}
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// WebSocketConn is a websocket connection, that implements Conn.
+type WebSocketConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	// clients mask the frames they send, servers do not
+	client bool
+	cfg    wsConfig
+
+	readMu sync.Mutex
+	// buffer of the frame header
+	header [14]byte
+
+	writeMu   sync.Mutex
+	closeSent bool
+	// set by Close, to not extend the close timeout with the keepalive read deadline
+	closing atomic.Bool
+	// closed when the close frame of the peer is received
+	closeRecv     chan struct{}
+	closeRecvOnce sync.Once
+
+	closeOnce sync.Once
+	// closed when the network connection is closed
+	done chan struct{}
+}
+
+var _ Conn = (*WebSocketConn)(nil)
+
+func newWebSocketConn(conn net.Conn, br *bufio.Reader, client bool, cfg wsConfig) *WebSocketConn {
+	c := &WebSocketConn{
+		conn:      conn,
+		br:        br,
+		client:    client,
+		cfg:       cfg,
+		closeRecv: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if cfg.pingInterval > 0 {
+		go c.keepalive()
+	}
+	return c
+}
+
+func (c *WebSocketConn) keepalive() {
+	ticker := time.NewTicker(c.cfg.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.writeControl(wsPing, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Read reads the next message. Pings are answered while reading.
+// If the context is done before a message is read, the connection is closed.
+func (c *WebSocketConn) Read(ctx context.Context) ([]byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	stop := context.AfterFunc(ctx, c.closeNow)
+	defer stop()
+	data, err := c.readMessage()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return data, err
+}
+
+func (c *WebSocketConn) readMessage() ([]byte, error) {
+	var msg []byte
+	var opcode byte
+	for {
+		if c.cfg.pingInterval > 0 && !c.closing.Load() {
+			_ = c.conn.SetReadDeadline(time.Now().Add(2 * c.cfg.pingInterval))
+		}
+		fin, op, length, mask, err := c.readFrameHeader()
+		if err != nil {
+			return nil, c.fail(err)
+		}
+		if op >= wsClose {
+			if !fin || length > wsMaxControlPayloadLen {
+				return nil, c.failWith(wsCloseProtocolError, "invalid control frame")
+			}
+			payload, err := c.readPayload(nil, length, mask)
+			if err != nil {
+				return nil, c.fail(err)
+			}
+			switch op {
+			case wsPing:
+				if err := c.writeControl(wsPong, payload); err != nil {
+					return nil, c.fail(err)
+				}
+			case wsPong:
+			case wsClose:
+				return nil, c.handleClose(payload)
+			default:
+				return nil, c.failWith(wsCloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+			}
+			continue
+		}
+		switch op {
+		case wsContinuation:
+			if opcode == 0 {
+				return nil, c.failWith(wsCloseProtocolError, "unexpected continuation frame")
+			}
+		case wsText, wsBinary:
+			if opcode != 0 {
+				return nil, c.failWith(wsCloseProtocolError, "expected continuation frame")
+			}
+			opcode = op
+		default:
+			return nil, c.failWith(wsCloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+		}
+		if length > uint64(c.cfg.readLimit-int64(len(msg))) {
+			return nil, c.failWith(wsCloseMessageTooBig, fmt.Sprintf("message exceeds %d bytes", c.cfg.readLimit))
+		}
+		if msg, err = c.readPayload(msg, length, mask); err != nil {
+			return nil, c.fail(err)
+		}
+		if fin {
+			if opcode == wsText && !utf8.Valid(msg) {
+				return nil, c.failWith(wsCloseInvalidPayload, "invalid UTF-8 in text message")
+			}
+			if msg == nil {
+				msg = []byte{}
+			}
+			return msg, nil
+		}
+	}
+}
+
+var errWSProtocol = errors.New("websocket protocol error")
+
+func (c *WebSocketConn) readFrameHeader() (fin bool, op byte, length uint64, mask []byte, err error) {
+	h := c.header[:2]
+	if _, err = io.ReadFull(c.br, h); err != nil {
+		return
+	}
+	fin, op = h[0]&0x80 != 0, h[0]&0x0F
+	if h[0]&0x70 != 0 {
+		err = fmt.Errorf("%w: reserved bits set", errWSProtocol)
+		return
+	}
+	masked := h[1]&0x80 != 0
+	if masked == c.client {
+		err = fmt.Errorf("%w: frames from clients must be masked, and from servers must not be", errWSProtocol)
+		return
+	}
+	length = uint64(h[1] & 0x7F)
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(c.br, c.header[2:4]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(c.header[2:4]))
+	case 127:
+		if _, err = io.ReadFull(c.br, c.header[2:10]); err != nil {
+			return
+		}
+		if length = binary.BigEndian.Uint64(c.header[2:10]); length>>63 != 0 {
+			err = fmt.Errorf("%w: invalid payload length", errWSProtocol)
+			return
+		}
+	}
+	if masked {
+		mask = c.header[10:14]
+		_, err = io.ReadFull(c.br, mask)
+	}
+	return
+}
+
+// readPayload appends the unmasked payload of the frame to buf.
+func (c *WebSocketConn) readPayload(buf []byte, length uint64, mask []byte) ([]byte, error) {
+	start := len(buf)
+	buf = append(buf, make([]byte, length)...)
+	if _, err := io.ReadFull(c.br, buf[start:]); err != nil {
+		return nil, err
+	}
+	if mask != nil {
+		maskBytes(mask, buf[start:])
+	}
+	return buf, nil
+}
+
+func maskBytes(mask []byte, data []byte) {
+	for i := range data {
+		data[i] ^= mask[i&3]
+	}
+}
+
+// handleClose answers the close frame of the peer, if this side did not start the close handshake, and closes.
+func (c *WebSocketConn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: wsCloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return c.failWith(wsCloseProtocolError, "invalid close frame")
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !utf8.Valid(payload[2:]) {
+			return c.failWith(wsCloseInvalidPayload, "invalid UTF-8 in close reason")
+		}
+	}
+	c.closeRecvOnce.Do(func() { close(c.closeRecv) })
+	if closeErr.Code == wsCloseNoStatus {
+		_ = c.writeClose(nil)
+	} else {
+		_ = c.writeClose(payload[:2])
+	}
+	c.closeNow()
+	return closeErr
+}
+
+// fail closes the connection because of the read error.
+func (c *WebSocketConn) fail(err error) error {
+	if errors.Is(err, errWSProtocol) {
+		return c.failWith(wsCloseProtocolError, err.Error())
+	}
+	c.closeNow()
+	return err
+}
+
+// failWith closes the connection with the status code, and returns the error.
+func (c *WebSocketConn) failWith(code int, reason string) error {
+	_ = c.writeClose(closePayload(code, reason))
+	c.closeNow()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func closePayload(code int, reason string) []byte {
+	if len(reason) > wsMaxControlPayloadLen-2 {
+		reason = reason[:wsMaxControlPayloadLen-2]
+	}
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), strings.ToValidUTF8(reason, "")...)
+}
+
+// Write writes the message as text frame, or as fragments if a frame size is configured.
+// If the context is done before the message is written, the connection is closed.
+func (c *WebSocketConn) Write(ctx context.Context, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return errors.New("websocket is closing")
+	}
+	stop := context.AfterFunc(ctx, c.closeNow)
+	defer stop()
+	deadline, _ := ctx.Deadline()
+	_ = c.conn.SetWriteDeadline(deadline)
+	op := byte(wsText)
+	for {
+		frame := data
+		if c.cfg.frameSize > 0 && len(frame) > c.cfg.frameSize {
+			frame = frame[:c.cfg.frameSize]
+		}
+		data = data[len(frame):]
+		if err := c.writeFrame(len(data) == 0, op, frame); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		op = wsContinuation
+	}
+}
+
+func (c *WebSocketConn) writeControl(op byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return errors.New("websocket is closing")
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.writeFrame(true, op, payload)
+}
+
+// writeClose sends the close frame, unless it was sent already.
+func (c *WebSocketConn) writeClose(payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+	_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.writeFrame(true, wsClose, payload)
+}
+
+// writeFrame writes a single frame. The caller must hold the write lock.
+func (c *WebSocketConn) writeFrame(fin bool, op byte, payload []byte) error {
+	var header [14]byte
+	header[0] = op
+	if fin {
+		header[0] |= 0x80
+	}
+	n := 2
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+		n = 4
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+		n = 10
+	}
+	frame := make([]byte, 0, n+4+len(payload))
+	if c.client {
+		header[1] |= 0x80
+		mask := header[n : n+4]
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		n += 4
+		frame = append(append(frame, header[:n]...), payload...)
+		maskBytes(mask, frame[n:])
+	} else {
+		frame = append(append(frame, header[:n]...), payload...)
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close starts or completes the close handshake, with status 1000, and closes the connection.
+func (c *WebSocketConn) Close() error {
+	err := c.writeClose(closePayload(wsCloseNormal, ""))
+	c.closing.Store(true)
+	if c.readMu.TryLock() {
+		// nothing is reading, so read the close frame of the peer here
+		_ = c.conn.SetReadDeadline(time.Now().Add(wsCloseTimeout))
+		for {
+			if _, err := c.readMessage(); err != nil {
+				break
+			}
+		}
+		c.readMu.Unlock()
+	} else {
+		select {
+		case <-c.closeRecv:
+		case <-c.done:
+		case <-time.After(wsCloseTimeout):
+		}
+	}
+	c.closeNow()
+	return err
+}
+
+func (c *WebSocketConn) closeNow() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerHasToken checks if the comma-separated header values contain the token, case-insensitively.
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UpgradeWebSocket completes the websocket handshake of the HTTP request, and takes over its connection.
+// If the handshake fails, an HTTP error is written, and returned.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request, opts ...WebSocketOption) (*WebSocketConn, error) {
+	return upgradeWebSocket(w, r, newWSConfig(opts))
+}
+
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, cfg wsConfig) (*WebSocketConn, error) {
+	fail := func(status int, msg string) (*WebSocketConn, error) {
+		http.Error(w, msg, status)
+		return nil, errors.New("websocket handshake failed: " + msg)
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		return fail(http.StatusMethodNotAllowed, "websocket requires GET")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "not a websocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return fail(http.StatusBadRequest, "invalid websocket key")
+	}
+	if !cfg.checkOrigin(r) {
+		return fail(http.StatusForbidden, "origin not allowed")
+	}
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fail(http.StatusInternalServerError, "cannot take over the connection")
+	}
+	_ = conn.SetDeadline(time.Time{})
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return newWebSocketConn(conn, brw.Reader, false, cfg), nil
+}
+
+// DialWebSocket opens a websocket connection to the ws:// or wss:// URL.
+func DialWebSocket(ctx context.Context, rawURL string, opts ...WebSocketOption) (*WebSocketConn, error) {
+	cfg := newWSConfig(opts)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	var dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		dial = (&net.Dialer{}).DialContext
+	case "wss":
+		u.Scheme = "https"
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		dial = (&tls.Dialer{}).DialContext
+	default:
+		return nil, fmt.Errorf("unsupported websocket URL scheme %q", u.Scheme)
+	}
+	conn, err := dial(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := handshakeWebSocket(ctx, conn, u, cfg)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func handshakeWebSocket(ctx context.Context, conn net.Conn, u *url.URL, cfg wsConfig) (*WebSocketConn, error) {
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+	var k [16]byte
+	if _, err := rand.Read(k[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(k[:])
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     cfg.header.Clone(),
+		Host:       u.Host,
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHTTPErrorBody))
+		_ = resp.Body.Close()
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+	}
+	if !headerHasToken(resp.Header, "Connection", "upgrade") || !headerHasToken(resp.Header, "Upgrade", "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return nil, errors.New("invalid websocket handshake response")
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return newWebSocketConn(conn, br, true, cfg), nil
+}
+
+// WebSocketHandler serves JSON-RPC over websockets: each connection is served by a Peer,
+// so handlers can notify the client, e.g. for subscriptions, with the Notifier in the request context.
+type WebSocketHandler struct {
+	handler Handler
+	cfg     wsConfig
+}
+
+var _ http.Handler = (*WebSocketHandler)(nil)
+
+// NewWebSocketHandler creates an http.Handler that upgrades requests to websockets, and serves the handler on them.
+func NewWebSocketHandler(h Handler, opts ...WebSocketOption) *WebSocketHandler {
+	return &WebSocketHandler{handler: h, cfg: newWSConfig(opts)}
+}
+
+// ServeHTTP upgrades the request, and serves the connection until it is closed.
+func (s *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r, s.cfg)
+	if err != nil {
+		return
+	}
+	peer := NewPeer(conn, s.handler, s.cfg.peerOptions...)
+	_ = peer.Run(r.Context())
+}
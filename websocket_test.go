@@ -0,0 +1,255 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newWebSocketServer serves the handler over websockets on loopback,
+// and reports the result of each connection when its peer stops.
+func newWebSocketServer(t *testing.T, h Handler, opts ...WebSocketOption) (string, chan struct{}) {
+	t.Helper()
+	ws := NewWebSocketHandler(h, opts...)
+	done := make(chan struct{}, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeHTTP(w, r)
+		done <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), done
+}
+
+func dialPeer(t *testing.T, url string, h Handler, opts ...WebSocketOption) *Peer {
+	t.Helper()
+	conn, err := DialWebSocket(context.Background(), url, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := NewPeer(conn, h)
+	go func() { _ = peer.Run(context.Background()) }()
+	t.Cleanup(func() { _ = peer.Close() })
+	return peer
+}
+
+func TestWebSocket(t *testing.T) {
+	subscribe := HandlerFunc(func(ctx context.Context, req *Message) *Message {
+		if req.Method != "subscribe" {
+			return specHandler(ctx, req)
+		}
+		n, ok := NotifierFromContext(ctx)
+		if !ok {
+			return req.RespondErr(ConstErrorObj(InternalError))
+		}
+		go func() {
+			for i := 0; i < 3; i++ {
+				select {
+				case <-n.Closed():
+					return
+				default:
+				}
+				_ = n.Notify(context.Background(), "subscription", []int{i})
+			}
+		}()
+		return req.Respond("0x1")
+	})
+	url, done := newWebSocketServer(t, subscribe, WebSocketPingInterval(20*time.Millisecond))
+
+	t.Run("call", func(t *testing.T) {
+		peer := dialPeer(t, url, nil)
+		var result int
+		if err := peer.Call(context.Background(), "subtract", []int{42, 23}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 19 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+		var obj *ErrorObject
+		if err := peer.Call(context.Background(), "foo.get", nil, nil); !errors.As(err, &obj) || obj.Code != MethodNotFound.Code() {
+			t.Fatalf("expected method not found, got %v", err)
+		}
+	})
+	t.Run("subscription", func(t *testing.T) {
+		notifications := make(chan string, 3)
+		peer := dialPeer(t, url, HandlerFunc(func(ctx context.Context, req *Message) *Message {
+			notifications <- string(req.Params)
+			return nil
+		}))
+		var id string
+		if err := peer.Call(context.Background(), "subscribe", nil, &id); err != nil {
+			t.Fatal(err)
+		}
+		for i, expected := range []string{"[0]", "[1]", "[2]"} {
+			select {
+			case params := <-notifications:
+				if params != expected {
+					t.Fatalf("unexpected notification %d: %s", i, params)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("missing notification %d", i)
+			}
+		}
+	})
+	t.Run("fragmentation", func(t *testing.T) {
+		// messages of the client are written in small frames, and must be reassembled by the server
+		peer := dialPeer(t, url, nil, WebSocketFrameSize(7))
+		var result int
+		if err := peer.Call(context.Background(), "sum", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != 55 {
+			t.Fatalf("unexpected result: %d", result)
+		}
+	})
+	t.Run("keepalive", func(t *testing.T) {
+		// an idle connection survives, since the peer answers pings
+		url, done := newWebSocketServer(t, subscribe, WebSocketPingInterval(20*time.Millisecond))
+		peer := dialPeer(t, url, nil)
+		select {
+		case <-done:
+			t.Fatal("idle connection closed")
+		case <-time.After(100 * time.Millisecond): // several times the read deadline of the server
+		}
+		if err := peer.Call(context.Background(), "sum", []int{1}, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("dead peer", func(t *testing.T) {
+		// a client that does not read does not answer pings, and is disconnected by the server
+		conn, err := DialWebSocket(context.Background(), url, WebSocketPingInterval(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.closeNow()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("dead connection not closed")
+		}
+	})
+	t.Run("close handshake", func(t *testing.T) {
+		conn, err := DialWebSocket(context.Background(), url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if err := conn.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d >= wsCloseTimeout {
+			t.Fatalf("close handshake did not complete, took %s", d)
+		}
+		if _, err := conn.Read(context.Background()); err == nil {
+			t.Fatal("expected error after close")
+		}
+	})
+}
+
+func TestWebSocketCloseUnresponsivePeer(t *testing.T) {
+	// the peer reads, but never answers the close frame
+	local, remote := net.Pipe()
+	defer remote.Close()
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+	conn := newWebSocketConn(local, bufio.NewReader(local), true, newWSConfig([]WebSocketOption{WebSocketPingInterval(3 * time.Second)}))
+	start := time.Now()
+	_ = conn.Close()
+	if d := time.Since(start); d > 2*wsCloseTimeout {
+		t.Fatalf("close took %s, expected at most the close timeout", d)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	url, _ := newWebSocketServer(t, specHandler, WebSocketReadLimit(64))
+	for _, tc := range []struct {
+		name string
+		// raw frame written by the client, or nil to write the message normally
+		frame   []byte
+		message string
+		code    int
+	}{
+		{name: "too big", message: `{"jsonrpc": "2.0", "method": "sum", "params": [` + strings.Repeat("1,", 50) + `1], "id": 1}`, code: wsCloseMessageTooBig},
+		{name: "invalid UTF-8", message: "{\"jsonrpc\": \"2.0\", \"method\": \"\xff\", \"id\": 1}", code: wsCloseInvalidPayload},
+		{name: "unmasked", frame: []byte{0x81, 0x02, '{', '}'}, code: wsCloseProtocolError},
+		{name: "reserved bits", frame: []byte{0xC1, 0x80, 0, 0, 0, 0}, code: wsCloseProtocolError},
+		{name: "unknown opcode", frame: []byte{0x83, 0x80, 0, 0, 0, 0}, code: wsCloseProtocolError},
+		{name: "fragmented control frame", frame: []byte{0x09, 0x80, 0, 0, 0, 0}, code: wsCloseProtocolError},
+		{name: "unexpected continuation", frame: []byte{0x80, 0x80, 0, 0, 0, 0}, code: wsCloseProtocolError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := DialWebSocket(context.Background(), url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if tc.frame != nil {
+				_, err = conn.conn.Write(tc.frame)
+			} else {
+				err = conn.Write(context.Background(), []byte(tc.message))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = conn.Read(context.Background())
+			var closeErr *CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != tc.code {
+				t.Fatalf("expected close with status %d, got %v", tc.code, err)
+			}
+		})
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	url, _ := newWebSocketServer(t, specHandler)
+	httpURL := "http" + strings.TrimPrefix(url, "ws")
+	for _, tc := range []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{"not an upgrade", map[string]string{}, http.StatusBadRequest},
+		{"version", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8",
+			"Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ=="}, http.StatusUpgradeRequired},
+		{"invalid key", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13",
+			"Sec-WebSocket-Key": "short"}, http.StatusBadRequest},
+		{"cross origin", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13",
+			"Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ==", "Origin": "https://evil.example"}, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, httpURL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+	t.Run("accept key", func(t *testing.T) {
+		// example from RFC 6455 section 1.3
+		if accept := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Fatalf("unexpected accept key: %s", accept)
+		}
+	})
+	t.Run("dial error", func(t *testing.T) {
+		_, err := DialWebSocket(context.Background(), url, WebSocketHeader("Origin", "https://evil.example"))
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected HTTP error, got %v", err)
+		}
+	})
+}